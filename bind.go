@@ -0,0 +1,201 @@
+package form
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// DefaultMaxBodySize is the default limit of request bodies read by Binder.
+	DefaultMaxBodySize = 10 << 20
+)
+
+var (
+	// ErrBodyTooLarge is the cause of a BindError for request bodies over the limit.
+	ErrBodyTooLarge = errors.New("request body too large")
+	// ErrUnsupportedMediaType is the cause of a BindError for request bodies which are not forms.
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+)
+
+// DefaultBinder is the Binder used by BindRequest, BindQuery and BindPostForm.
+var DefaultBinder = &Binder{
+	MaxBodySize: DefaultMaxBodySize,
+}
+
+// BindError describes a request which cannot be bound,
+// with the HTTP status code suitable for the response.
+type BindError struct {
+	Status int   // 400, 413 or 415
+	Err    error // underlying error, e.g. *DecodeError or MultiError
+}
+
+func (e *BindError) Error() string {
+	return fmt.Sprintf("form: bind request: %v", e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// Binder decodes HTTP requests into structs.
+type Binder struct {
+	// MaxBodySize is the maximum number of bytes read from request bodies,
+	// no limit if zero or negative.
+	MaxBodySize int64
+	// Options are passed to each Decoder, e.g. WithCaseInsensitive(true).
+	Options []Option
+	// Configure, if not nil, is called to set up each Decoder before decoding.
+	Configure func(*Decoder)
+}
+
+// BindRequest decodes r into dst with DefaultBinder.
+func BindRequest(r *http.Request, dst interface{}) error {
+	return DefaultBinder.BindRequest(r, dst)
+}
+
+// BindQuery decodes the URL query of r into dst with DefaultBinder.
+func BindQuery(r *http.Request, dst interface{}) error {
+	return DefaultBinder.BindQuery(r, dst)
+}
+
+// BindPostForm decodes the form body of r into dst with DefaultBinder.
+func BindPostForm(r *http.Request, dst interface{}) error {
+	return DefaultBinder.BindPostForm(r, dst)
+}
+
+// BindRequest decodes r into dst. The URL query is used for GET, HEAD, OPTIONS
+// and DELETE requests, and requests without a body. Otherwise, the form body
+// is required and takes precedence over the URL query.
+func (b *Binder) BindRequest(r *http.Request, dst interface{}) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodDelete:
+		return b.BindQuery(r, dst)
+	}
+	if r.Header.Get("Content-Type") == "" && (r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0) {
+		return b.BindQuery(r, dst)
+	}
+
+	if err := b.parseBody(r); err != nil {
+		return err
+	}
+	return b.decode(r.Form, multipartFiles(r), dst)
+}
+
+// BindQuery decodes the URL query of r into dst.
+func (b *Binder) BindQuery(r *http.Request, dst interface{}) error {
+	values, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return &BindError{
+			Status: http.StatusBadRequest,
+			Err:    err,
+		}
+	}
+	return b.decode(values, nil, dst)
+}
+
+// BindPostForm decodes the form body of r into dst, ignoring the URL query.
+func (b *Binder) BindPostForm(r *http.Request, dst interface{}) error {
+	if err := b.parseBody(r); err != nil {
+		return err
+	}
+	return b.decode(r.PostForm, multipartFiles(r), dst)
+}
+
+// parseBody parses the form body of r, within the body size limit.
+func (b *Binder) parseBody(r *http.Request) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/x-www-form-urlencoded" && mediaType != "multipart/form-data" {
+		return &BindError{
+			Status: http.StatusUnsupportedMediaType,
+			Err:    ErrUnsupportedMediaType,
+		}
+	}
+
+	if b.MaxBodySize > 0 && r.Body != nil {
+		if r.ContentLength > b.MaxBodySize {
+			return &BindError{
+				Status: http.StatusRequestEntityTooLarge,
+				Err:    ErrBodyTooLarge,
+			}
+		}
+		r.Body = &limitedBody{
+			ReadCloser: r.Body,
+			n:          b.MaxBodySize,
+		}
+	}
+
+	if mediaType == "multipart/form-data" {
+		maxMemory := b.MaxBodySize
+		if maxMemory <= 0 {
+			maxMemory = DefaultMaxBodySize
+		}
+		err = r.ParseMultipartForm(maxMemory)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrBodyTooLarge) {
+			status, err = http.StatusRequestEntityTooLarge, ErrBodyTooLarge
+		}
+		return &BindError{
+			Status: status,
+			Err:    err,
+		}
+	}
+	return nil
+}
+
+// multipartFiles returns the files uploaded with r, nil if r is not a multipart form.
+func multipartFiles(r *http.Request) map[string][]*multipart.FileHeader {
+	if r.MultipartForm == nil {
+		return nil
+	}
+	return r.MultipartForm.File
+}
+
+func (b *Binder) decode(values url.Values, files map[string][]*multipart.FileHeader, dst interface{}) error {
+	d := NewDecoder(values, b.Options...)
+	d.files = files
+	if b.Configure != nil {
+		b.Configure(d)
+	}
+	err := d.Decode(dst)
+	if err == nil || err == TypeError {
+		return err
+	}
+	return &BindError{
+		Status: http.StatusBadRequest,
+		Err:    err,
+	}
+}
+
+// limitedBody reads at most n bytes from a request body,
+// and fails with ErrBodyTooLarge if there are more.
+type limitedBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// Check whether the body ends right at the limit.
+		var b [1]byte
+		if n, err := l.ReadCloser.Read(b[:]); n == 0 {
+			return 0, err
+		}
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
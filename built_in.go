@@ -4,12 +4,20 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"time"
 )
 
 const (
 	NullValue = "null"
 )
 
+const (
+	// UnixLayout encodes time.Time as seconds since the Unix epoch.
+	UnixLayout = "unix"
+	// UnixMilliLayout encodes time.Time as milliseconds since the Unix epoch.
+	UnixMilliLayout = "unixmilli"
+)
+
 var (
 	BoolType      = reflect.TypeOf(Bool(false))
 	Int64Type     = reflect.TypeOf(Int64(0))
@@ -18,6 +26,11 @@ var (
 	Float64Type   = reflect.TypeOf(Float64(0.0))
 	StringType    = reflect.TypeOf(String(""))
 	InterfaceType = reflect.TypeOf(Interface{})
+	TimeType      = reflect.TypeOf(Time{})
+	DurationType  = reflect.TypeOf(Duration(0))
+
+	stdTimeType     = reflect.TypeOf(time.Time{})
+	stdDurationType = reflect.TypeOf(time.Duration(0))
 )
 
 type Bool bool
@@ -133,3 +146,78 @@ func (v *Interface) UnmarshalURL(src string) error {
 	v.Val = src
 	return nil
 }
+
+// Time is a time.Time formatted with Layout, which is either a time layout,
+// UnixLayout or UnixMilliLayout.
+type Time struct {
+	Time   time.Time
+	Layout string
+}
+
+func (v Time) MarshalURL() (string, error) {
+	switch v.Layout {
+	case UnixLayout:
+		return strconv.FormatInt(v.Time.Unix(), 10), nil
+	case UnixMilliLayout:
+		return strconv.FormatInt(v.Time.UnixNano()/int64(time.Millisecond), 10), nil
+	default:
+		return v.Time.Format(v.Layout), nil
+	}
+}
+
+func (v *Time) UnmarshalURL(src string) error {
+	if src == "" {
+		return nil
+	}
+	switch v.Layout {
+	case UnixLayout, UnixMilliLayout:
+		val, err := strconv.ParseInt(src, 10, 64)
+		if err != nil {
+			return err
+		}
+		if v.Layout == UnixLayout {
+			v.Time = time.Unix(val, 0)
+		} else {
+			v.Time = time.Unix(0, val*int64(time.Millisecond))
+		}
+	default:
+		val, err := time.Parse(v.Layout, src)
+		if err != nil {
+			return err
+		}
+		v.Time = val
+	}
+	return nil
+}
+
+type Duration time.Duration
+
+func (v Duration) MarshalURL() (string, error) {
+	return time.Duration(v).String(), nil
+}
+
+func (v *Duration) UnmarshalURL(src string) error {
+	if src == "" {
+		return nil
+	}
+	val, err := time.ParseDuration(src)
+	if err != nil {
+		return err
+	}
+	*v = Duration(val)
+	return nil
+}
+
+// timeLayout returns the time layout set in the field options, or def if none.
+func timeLayout(opts tagOptions, def string) string {
+	switch {
+	case opts.Contains(UnixLayout):
+		return UnixLayout
+	case opts.Contains(UnixMilliLayout):
+		return UnixMilliLayout
+	}
+	if layout, ok := opts.Get("layout"); ok {
+		return layout
+	}
+	return def
+}
@@ -0,0 +1,236 @@
+package form
+
+import (
+	"encoding"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// strategy is the conversion chosen for a type when it is encoded or decoded.
+type strategy uint8
+
+const (
+	// strategyNone means the type is walked recursively (pointers, structs,
+	// slices, arrays and maps) or not supported at all.
+	strategyNone strategy = iota
+	// strategyAddr means the pointer to the type implements the interface.
+	strategyAddr
+	// strategyValue means the type itself implements the interface.
+	strategyValue
+	// strategyKind means the type is converted by its built-in kind.
+	strategyKind
+	// strategyTime means the type is time.Time or time.Duration.
+	strategyTime
+	// strategyTextAddr means the pointer to the type implements the encoding.Text* interface.
+	strategyTextAddr
+	// strategyTextValue means the type itself implements the encoding.Text* interface.
+	strategyTextValue
+)
+
+// text reports whether the strategy falls back to encoding.TextMarshaler
+// or encoding.TextUnmarshaler.
+func (s strategy) text() bool {
+	return s == strategyTextAddr || s == strategyTextValue
+}
+
+// codec holds the strategies chosen for a type.
+type codec struct {
+	marshal   strategy
+	unmarshal strategy
+}
+
+func newCodec(t reflect.Type) codec {
+	return codec{
+		marshal:   marshalStrategy(t),
+		unmarshal: unmarshalStrategy(t),
+	}
+}
+
+// field is the precomputed plan of a struct field.
+type field struct {
+	codec
+	name      string
+	ignored   bool   // excluded from the form
+	fold      string // lower case name, for case-insensitive matching
+	fieldName string // name of the Go struct field
+	opts      tagOptions
+	index     int
+	typ       reflect.Type
+	elem      codec    // element of pointers, slices, arrays and maps
+	key       codec    // key of maps
+	inline    bool     // fields of a nested struct are kept in the parent namespace
+	file      bool     // bound to uploaded files, see NewMultipartDecoder
+	upload    bool     // written as a file part, see NewMultipartEncoder
+	defaults  []string // values used when the key is missing or empty
+	rules     []rule   // validation rules, see ValidateTagName
+	sep       string   // separator of slice values, see WithSeparator
+}
+
+// structPlan is the precomputed plan of a struct type.
+type structPlan struct {
+	fields []field
+}
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+var (
+	planCache  sync.Map // map[planKey]*structPlan
+	codecCache sync.Map // map[reflect.Type]codec
+)
+
+// cachedCodec returns the codec of the type t, building it on first use.
+func cachedCodec(t reflect.Type) codec {
+	if c, ok := codecCache.Load(t); ok {
+		return c.(codec)
+	}
+	c, _ := codecCache.LoadOrStore(t, newCodec(t))
+	return c.(codec)
+}
+
+// planKey identifies the plan of a struct type read with comma-separated tag names
+// and a naming strategy.
+type planKey struct {
+	typ    reflect.Type
+	tags   string
+	naming string
+}
+
+// cachedPlan returns the plan of the struct type t read with the options o,
+// building it on first use.
+func cachedPlan(t reflect.Type, o *options) *structPlan {
+	key := planKey{t, o.tagNames, o.naming}
+	if p, ok := planCache.Load(key); ok {
+		return p.(*structPlan)
+	}
+	p, _ := planCache.LoadOrStore(key, newPlan(t, o.tagNames, lookupNaming(o.naming)))
+	return p.(*structPlan)
+}
+
+// newPlan builds the plan of the struct type t read with the comma-separated tag names tags.
+// Go names of fields without a tag name are converted by rename if not nil.
+func newPlan(t reflect.Type, tags string, rename func(string) string) *structPlan {
+	p := &structPlan{
+		fields: make([]field, 0, t.NumField()),
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, opts := fieldAlias(sf, tags, rename)
+		f := field{
+			codec:     newCodec(sf.Type),
+			name:      name,
+			ignored:   isIgnored(sf, tags),
+			fold:      strings.ToLower(name),
+			fieldName: sf.Name,
+			opts:      opts,
+			index:     i,
+			typ:       sf.Type,
+			inline:    opts.Contains("inline"),
+			file:      isFileType(sf.Type),
+			upload:    isUploadType(sf.Type) || opts.Contains("file"),
+			rules:     fieldRules(sf),
+		}
+		if _, ok := opts.Get("file"); ok {
+			f.upload = true
+		}
+		f.sep = sepOption(opts)
+		if def, ok := opts.Get("default"); ok {
+			f.defaults = []string{def}
+			if k := sf.Type.Kind(); (k == reflect.Slice || k == reflect.Array) && f.unmarshal == strategyNone {
+				f.defaults = strings.Split(def, "|")
+			}
+		}
+		// Embedded structs without an explicit name are inlined like encoding/json does.
+		tag, _ := fieldTag(sf, tags)
+		if alias, _ := parseTag(tag); sf.Anonymous && alias == "" {
+			f.inline = true
+		}
+		switch sf.Type.Kind() {
+		case reflect.Map:
+			f.key = newCodec(sf.Type.Key())
+			fallthrough
+		case reflect.Ptr, reflect.Slice, reflect.Array:
+			f.elem = newCodec(sf.Type.Elem())
+		}
+		p.fields = append(p.fields, f)
+	}
+	return p
+}
+
+// sepOption returns the separator of slice values set by the sep or comma options.
+func sepOption(opts tagOptions) string {
+	if sep, ok := opts.Get("sep"); ok {
+		return sep
+	}
+	if opts.Contains("comma") {
+		return ","
+	}
+	return ""
+}
+
+func marshalStrategy(t reflect.Type) strategy {
+	if t.Implements(marshalerType) {
+		return strategyValue
+	}
+	if reflect.PtrTo(t).Implements(marshalerType) {
+		return strategyAddr
+	}
+	if t == stdTimeType || t == stdDurationType {
+		return strategyTime
+	}
+	if isConcrete(t) && t.Implements(textMarshalerType) {
+		return strategyTextValue
+	}
+	if isConcrete(t) && reflect.PtrTo(t).Implements(textMarshalerType) {
+		return strategyTextAddr
+	}
+	if isBuiltinKind(t.Kind()) {
+		return strategyKind
+	}
+	return strategyNone
+}
+
+func unmarshalStrategy(t reflect.Type) strategy {
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return strategyAddr
+	}
+	if t.Implements(unmarshalerType) {
+		return strategyValue
+	}
+	if t == stdTimeType || t == stdDurationType {
+		return strategyTime
+	}
+	if isConcrete(t) && reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return strategyTextAddr
+	}
+	if isConcrete(t) && t.Implements(textUnmarshalerType) {
+		return strategyTextValue
+	}
+	if isBuiltinKind(t.Kind()) {
+		return strategyKind
+	}
+	return strategyNone
+}
+
+// isConcrete reports whether t is neither a pointer nor an interface.
+// Pointers are dereferenced before falling back to encoding.Text* interfaces,
+// so that the pointed types are converted with their own precedence.
+func isConcrete(t reflect.Type) bool {
+	return t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface
+}
+
+// isBuiltinKind reports whether values of kind k are converted by the
+// built-in types.
+func isBuiltinKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String, reflect.Interface:
+		return true
+	}
+	return false
+}
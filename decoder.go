@@ -1,9 +1,14 @@
 package form
 
 import (
+	"encoding"
 	"fmt"
+	"mime/multipart"
 	"net/url"
 	"reflect"
+	"sort"
+	"strings"
+	"time"
 )
 
 type Unmarshaler interface {
@@ -14,130 +19,920 @@ var (
 	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
 )
 
+const (
+	// DefaultMaxIndex is the default maximum index of indexed keys, e.g. items.1000.name.
+	DefaultMaxIndex = 1000
+	// DefaultMaxDepth is the default maximum depth of nested structs and maps.
+	DefaultMaxDepth = 32
+)
+
 type Decoder struct {
-	values url.Values
+	options
+	values     url.Values
+	files      map[string][]*multipart.FileHeader
+	nest       NestStyle
+	maxIndex   int
+	maxDepth   int
+	timeLayout string
+	converters map[reflect.Type]func(string) (reflect.Value, error)
+	noText     bool
+	noUnknown  bool
+	patch      bool
+
+	maxFileSize int64
+	maxFiles    int
 }
 
-func NewDecoder(src url.Values) *Decoder {
+func NewDecoder(src url.Values, opts ...Option) *Decoder {
 	return &Decoder{
-		values: src,
+		options:    newOptions(opts),
+		values:     src,
+		maxIndex:   DefaultMaxIndex,
+		maxDepth:   DefaultMaxDepth,
+		timeLayout: time.RFC3339,
 	}
 }
 
+// decodeState holds the state of a single Decode call.
+type decodeState struct {
+	src    url.Values
+	files  map[string][]*multipart.FileHeader
+	fields map[string]bool   // keys bound to struct fields
+	dotted bool              // keys of src are in dot notation, see canonicalValues
+	names  map[string]string // original keys of lower case keys, if case-insensitive
+	// original keys of lower case keys in dot notation, if case-insensitive
+	canonical map[string]string
+	errs      MultiError
+	touched   int // number of fields set from the form
+	depth     int
+	types     map[reflect.Type]int // structs being decoded
+}
+
+// originalNames returns the original case of the names of the entries nested in key,
+// e.g. Color for META.Color in meta, looking up the keys of src in origs,
+// either st.names or st.canonical. It returns nil unless case-insensitive.
+func originalNames(src url.Values, key string, origs map[string]string) map[string]string {
+	if origs == nil {
+		return nil
+	}
+	n := 0
+	if key != "" {
+		n = strings.Count(key, ".") + 1
+	}
+	names := map[string]string{}
+	for k := range src {
+		orig, ok := origs[k]
+		if !ok {
+			continue
+		}
+		// Case folding keeps the dots, so the entry is at the same position in the original key.
+		name, origName := keySegment(k, n), keySegment(orig, n)
+		if o, ok := names[name]; !ok || origName < o {
+			names[name] = origName
+		}
+	}
+	return names
+}
+
 func (d *Decoder) Decode(dst interface{}) error {
 	v := reflect.ValueOf(dst)
 	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
 		return TypeError
 	}
 
-	fields := map[string]bool{}
-	mapField, err := d.decode(v.Elem(), d.values, fields)
+	st := &decodeState{
+		src:    d.values,
+		files:  d.files,
+		fields: map[string]bool{},
+		types:  map[reflect.Type]int{},
+	}
+	if d.nest != NestFlat {
+		st.src = canonicalValues(st.src)
+		st.files = canonicalFiles(st.files)
+		st.dotted = true
+	}
+	if d.ignoreCase {
+		st.names = map[string]string{}
+		st.src = foldValues(st.src, st.names)
+		st.files = foldFiles(st.files, st.names)
+		st.canonical = make(map[string]string, len(st.names))
+		for lower, orig := range st.names {
+			lower, orig = canonicalKey(lower), canonicalKey(orig)
+			if o, ok := st.canonical[lower]; !ok || orig < o {
+				st.canonical[lower] = orig
+			}
+		}
+	}
+
+	mapField, err := d.decode(v.Elem(), "", "", st)
 	if err != nil {
 		return err
 	}
-	if !mapField.IsValid() {
+	if mapField != nil {
+		if err = d.decodeMap(mapField.v, mapField.path, st); err != nil {
+			return err
+		}
+	} else if d.noUnknown {
+		if err = d.checkUnknownKeys(st); err != nil {
+			return err
+		}
+	}
+	if len(st.errs) > 0 {
+		return st.errs
+	}
+	return nil
+}
+
+// SetNestStyle sets the way keys of nested struct fields are built, NestFlat by default.
+// Both dot and bracket notations are accepted unless the style is NestFlat.
+func (d *Decoder) SetNestStyle(s NestStyle) {
+	d.nest = s
+}
+
+// SetMaxIndex sets the maximum index accepted in indexed keys, DefaultMaxIndex by default.
+// Gaps between indices are kept as zero values, so the limit bounds the memory
+// allocated for a slice of structs.
+func (d *Decoder) SetMaxIndex(n int) {
+	d.maxIndex = n
+}
+
+// SetMaxDepth sets the maximum depth of nested structs and maps, DefaultMaxDepth by default.
+// Deeper keys fail with a *DepthError.
+func (d *Decoder) SetMaxDepth(n int) {
+	d.maxDepth = n
+}
+
+// descend increases the depth of nested values, and fails beyond the maximum depth.
+func (d *Decoder) descend(st *decodeState, t reflect.Type, key string) error {
+	if st.depth++; d.maxDepth > 0 && st.depth > d.maxDepth {
+		return &DepthError{
+			Key:   key,
+			Type:  t,
+			Depth: d.maxDepth,
+		}
+	}
+	return nil
+}
+
+// DisallowUnknownKeys causes Decode to report keys not bound to any field,
+// unless the struct has a map field catching them. All the unknown keys are
+// reported at once, as a MultiError if there are more than one.
+func (d *Decoder) DisallowUnknownKeys() {
+	d.noUnknown = true
+}
+
+// SetPatchMode sets whether Decode only sets the fields whose keys are present
+// in the form, leaving the others untouched, false by default. Pointers to structs
+// are only allocated if any of their fields is set, slices of structs are patched
+// element by element, and default values are ignored.
+func (d *Decoder) SetPatchMode(patch bool) {
+	d.patch = patch
+}
+
+// SetErrorMode sets the way decoding failures are reported, StopOnError by default.
+func (d *Decoder) SetErrorMode(m ErrorMode) {
+	d.errorMode = m
+}
+
+// SetTimeLayout sets the layout of time.Time fields without a layout option,
+// time.RFC3339 by default. UnixLayout and UnixMilliLayout are accepted as well.
+func (d *Decoder) SetTimeLayout(layout string) {
+	d.timeLayout = layout
+}
+
+// RegisterConverter registers fn to decode values of type t.
+// Converters are used when neither t nor a pointer to it implements Unmarshaler,
+// and take precedence over the built-in conversions.
+func (d *Decoder) RegisterConverter(t reflect.Type, fn func(string) (reflect.Value, error)) {
+	if d.converters == nil {
+		d.converters = map[reflect.Type]func(string) (reflect.Value, error){}
+	}
+	d.converters[t] = fn
+}
+
+// DisableTextUnmarshaler stops falling back to encoding.TextUnmarshaler for types
+// implementing neither Unmarshaler nor a registered converter.
+func (d *Decoder) DisableTextUnmarshaler() {
+	d.noText = true
+}
+
+// isLeaf reports whether values of type t, with unmarshal strategy s, are decoded from a single form value.
+func (d *Decoder) isLeaf(s strategy, t reflect.Type) bool {
+	if d.converters[t] != nil {
+		return true
+	}
+	if s.text() {
+		return !d.noText
+	}
+	return s != strategyNone
+}
+
+// isStruct reports whether t, or the type t points to, is a struct decoded field by field.
+// s is the unmarshal strategy of t.
+func (d *Decoder) isStruct(s strategy, t reflect.Type) bool {
+	if d.isLeaf(s, t) {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if d.isLeaf(cachedCodec(t).unmarshal, t) {
+			return false
+		}
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// fail records a decoding failure, and returns it if decoding must stop.
+func (d *Decoder) fail(st *decodeState, key, path, value string, err error) error {
+	if orig, ok := st.names[key]; ok {
+		key = orig
+	}
+	err = &DecodeError{
+		Key:   key,
+		Field: path,
+		Value: value,
+		Err:   err,
+	}
+	if d.errorMode == CollectErrors {
+		st.errs = append(st.errs, err)
 		return nil
 	}
+	return err
+}
 
-	t := mapField.Type()
-	m := reflect.MakeMapWithSize(reflect.MapOf(t.Key(), t.Elem()), len(d.values))
-	for k, vals := range d.values {
-		if fields[k] {
-			continue
+// checkUnknownKeys reports all the keys not bound to struct fields.
+func (d *Decoder) checkUnknownKeys(st *decodeState) error {
+	var keys []string
+	for k := range st.src {
+		if !st.fields[k] {
+			keys = append(keys, k)
 		}
+	}
+	for k := range st.files {
+		if _, ok := st.src[k]; !ok && !st.fields[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var errs MultiError
+	for _, k := range keys {
+		value := st.src.Get(k)
+		if fhs := st.files[k]; value == "" && len(fhs) > 0 {
+			value = fhs[0].Filename
+		}
+		if orig, ok := st.names[k]; ok {
+			k = orig
+		}
+		errs = append(errs, &DecodeError{
+			Key:   k,
+			Value: value,
+			Err:   ErrUnknownKey,
+		})
+	}
+	switch {
+	case d.errorMode == CollectErrors:
+		st.errs = append(st.errs, errs...)
+		return nil
+	case len(errs) == 0:
+		return nil
+	case len(errs) == 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// inlineMap is a map field with the inline option, holding the keys not bound to other fields.
+type inlineMap struct {
+	v    reflect.Value
+	path string // path of the field
+}
+
+// decodeMap decodes all the keys not bound to struct fields into the map field v in path.
+// Entries of nested values, e.g. structs, are grouped by the first segment of the keys.
+func (d *Decoder) decodeMap(v reflect.Value, path string, st *decodeState) error {
+	t := v.Type()
+	keyStrategy, elemStrategy := cachedCodec(t.Key()).unmarshal, cachedCodec(t.Elem()).unmarshal
+	nested := d.isNested(t.Elem())
+	m := v
+	if !d.patch || v.IsNil() {
+		m = reflect.MakeMapWithSize(reflect.MapOf(t.Key(), t.Elem()), len(st.src))
+	}
 
+	rest := url.Values{}
+	for k, vals := range st.src {
+		if !st.fields[k] {
+			rest[k] = vals
+		}
+	}
+	names := make([]string, 0, len(rest))
+	var (
+		origNames map[string]string
+		groups    map[string]url.Values // keys of each entry
+	)
+	if nested {
+		names = entryNames(rest, "")
+		origNames = originalNames(rest, "", st.names)
+		groups = make(map[string]url.Values, len(names))
+		for k, vals := range rest {
+			name := keySegment(k, 0)
+			if groups[name] == nil {
+				groups[name] = url.Values{}
+			}
+			groups[name][k] = vals
+		}
+	} else {
+		for k := range rest {
+			names = append(names, k)
+		}
+	}
+
+	src := st.src
+	st.src = rest
+	defer func() {
+		st.src = src
+	}()
+
+	for _, k := range names {
+		name := k
+		if orig, ok := origNames[k]; ok {
+			name = orig
+		} else if orig, ok = st.names[k]; ok {
+			name = orig
+		}
 		var (
 			key = reflect.New(t.Key()).Elem()
 			val = reflect.New(t.Elem()).Elem()
 		)
-		err := d.decodeElement(t.Key(), key, k)
+		err := d.decodeElement(keyStrategy, t.Key(), key, name, nil)
 		if err != nil {
 			continue
 		}
-		err = d.decodeElement(t.Elem(), val, vals[0])
-		if err != nil {
-			val = reflect.Zero(t.Elem())
+		if d.isLeaf(elemStrategy, t.Elem()) {
+			// Values which cannot be decoded are kept as zero values.
+			err = d.decodeElement(elemStrategy, t.Elem(), val, rest[k][0], nil)
+			if err != nil {
+				val = reflect.Zero(t.Elem())
+			}
+		} else {
+			// Nested entries are decoded from their own keys only.
+			if nested {
+				st.src = groups[k]
+			}
+			if err = d.decodeMapValue(val, k, fmt.Sprintf("%s[%s]", path, name), nil, st); err != nil {
+				return err
+			}
 		}
 		m.SetMapIndex(key, val)
 	}
 
-	mapField.Set(m)
+	// In patch mode, entries are merged into the existing map.
+	if !d.patch || len(names) > 0 {
+		v.Set(m)
+	}
 	return nil
 }
 
-func (d *Decoder) decodeElement(t reflect.Type, v reflect.Value, src string) (err error) {
-	if v.CanAddr() && v.Addr().Type().Implements(unmarshalerType) {
-		err = v.Addr().Interface().(Unmarshaler).UnmarshalURL(src)
-	} else if t.Implements(unmarshalerType) {
-		err = v.Interface().(Unmarshaler).UnmarshalURL(src)
-	} else {
-		err = d.unmarshal(t, v, src)
+// isNested reports whether map values of type t are decoded from nested keys,
+// e.g. structs, pointers to structs, maps and slices of structs.
+func (d *Decoder) isNested(t reflect.Type) bool {
+	if d.isLeaf(cachedCodec(t).unmarshal, t) {
+		return false
 	}
-	return err
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if d.isLeaf(cachedCodec(t).unmarshal, t) {
+			return false
+		}
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return true
+	case reflect.Slice, reflect.Array:
+		return d.isStruct(cachedCodec(t.Elem()).unmarshal, t.Elem())
+	}
+	return false
+}
+
+// decodeMapField decodes the keys nested in key, e.g. meta.color or meta[color],
+// into the map v, and returns the number of entries decoded.
+func (d *Decoder) decodeMapField(v reflect.Value, key, path string, opts tagOptions, st *decodeState) (int, error) {
+	defer func() {
+		st.depth--
+	}()
+	if err := d.descend(st, v.Type(), key); err != nil {
+		return 0, err
+	}
+
+	nested, consumed := nestedValues(st.src, key)
+	for _, k := range consumed {
+		st.fields[k] = true
+	}
+	names := entryNames(nested, key)
+	origNames := originalNames(nested, key, st.canonical)
+	if len(names) == 0 {
+		if !d.patch {
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return 0, nil
+	}
+
+	// Entries are decoded from the nested keys only, in dot notation.
+	src, dotted := st.src, st.dotted
+	st.src, st.dotted = nested, true
+	defer func() {
+		st.src, st.dotted = src, dotted
+	}()
+
+	t := v.Type()
+	keyStrategy := cachedCodec(t.Key()).unmarshal
+	if !d.patch || v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(t, len(names)))
+	}
+	for _, name := range names {
+		orig := name
+		if o, ok := origNames[name]; ok {
+			orig = o
+		}
+		entryKey, entryPath := NestDot.join(key, name), fmt.Sprintf("%s[%s]", path, orig)
+		mk := reflect.New(t.Key()).Elem()
+		if err := d.decodeElement(keyStrategy, t.Key(), mk, orig, nil); err != nil {
+			if err = d.fail(st, entryKey, entryPath, orig, err); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		ev := reflect.New(t.Elem()).Elem()
+		if err := d.decodeMapValue(ev, entryKey, entryPath, opts, st); err != nil {
+			return 0, err
+		}
+		v.SetMapIndex(mk, ev)
+	}
+	return len(names), nil
 }
 
-func (d *Decoder) decode(v reflect.Value, src url.Values, fields map[string]bool) (reflect.Value, error) {
+// decodeMapValue decodes the map entry key, and the keys nested in it, into v.
+func (d *Decoder) decodeMapValue(v reflect.Value, key, path string, opts tagOptions, st *decodeState) error {
+	t := v.Type()
+	s := cachedCodec(t).unmarshal
+	vals := st.src[key]
+	value := ""
+	if len(vals) > 0 {
+		value = vals[0]
+	}
+
+	switch {
+	case d.isLeaf(s, t):
+	case t.Kind() == reflect.Ptr:
+		if len(vals) > 0 && value == d.nullValue {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		v.Set(reflect.New(t.Elem()))
+		return d.decodeMapValue(v.Elem(), key, path, opts, st)
+	case t.Kind() == reflect.Struct:
+		_, err := d.decode(v, key, path, st)
+		return err
+	case t.Kind() == reflect.Map:
+		_, err := d.decodeMapField(v, key, path, opts, st)
+		return err
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && d.isStruct(cachedCodec(t.Elem()).unmarshal, t.Elem()):
+		return d.decodeStructs(v, key, path, st)
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		f := &field{
+			codec: cachedCodec(t),
+			opts:  opts,
+			typ:   t,
+			elem:  cachedCodec(t.Elem()),
+			sep:   sepOption(opts),
+		}
+		if d.arrayStyle != ArrayRepeat {
+			vals, _ = d.arrayValues(st, key, vals, true)
+		}
+		return d.decodeSlice(v, f, key, path, vals, st)
+	}
+
+	if err := d.decodeElement(s, t, v, value, opts); err != nil {
+		return d.fail(st, key, path, value, err)
+	}
+	return nil
+}
+
+func (d *Decoder) decodeElement(s strategy, t reflect.Type, v reflect.Value, src string, opts tagOptions) error {
+	// Precedence: Unmarshaler, converters, time types, encoding.TextUnmarshaler and built-in kinds.
+	switch s {
+	case strategyAddr:
+		if v.CanAddr() {
+			return v.Addr().Interface().(Unmarshaler).UnmarshalURL(src)
+		}
+	case strategyValue:
+		if t.Kind() == reflect.Ptr && v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return v.Interface().(Unmarshaler).UnmarshalURL(src)
+	}
+
+	if fn, ok := d.converters[t]; ok {
+		val, err := fn(src)
+		if err != nil {
+			return err
+		}
+		if !val.IsValid() || !val.Type().AssignableTo(t) {
+			return fmt.Errorf("converter of %v returns %v", t, val)
+		}
+		v.Set(val)
+		return nil
+	}
+
+	switch {
+	case s == strategyTime && t == stdDurationType:
+		val := Duration(0)
+		if err := val.UnmarshalURL(src); err != nil {
+			return err
+		}
+		v.SetInt(int64(val))
+		return nil
+	case s == strategyTime:
+		val := Time{
+			Layout: timeLayout(opts, d.timeLayout),
+		}
+		if err := val.UnmarshalURL(src); err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(val.Time))
+		return nil
+	case s.text() && !d.noText:
+		if src == "" {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		if s == strategyTextAddr && v.CanAddr() {
+			return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(src))
+		}
+		if s == strategyTextValue {
+			return v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(src))
+		}
+	case t.Kind() == reflect.Ptr:
+		if src == d.nullValue {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return d.decodeElement(cachedCodec(t.Elem()).unmarshal, t.Elem(), v.Elem(), src, opts)
+	}
+	return d.unmarshal(t, v, src)
+}
+
+// decode decodes the struct v, whose keys are nested in prefix and fields in path.
+// It returns the first inline map field found, and a non-nil error only if decoding must stop.
+func (d *Decoder) decode(v reflect.Value, prefix, path string, st *decodeState) (*inlineMap, error) {
 	var (
-		err            error
-		mapField       reflect.Value
-		recursionField reflect.Value
+		mapField *inlineMap
+		src      = st.src
 	)
+	defer func() {
+		st.depth--
+		st.types[v.Type()]--
+	}()
+	st.types[v.Type()]++
+	if err := d.descend(st, v.Type(), prefix); err != nil {
+		return mapField, err
+	}
 
-	t := v.Type()
+	for _, f := range cachedPlan(v.Type(), &d.options).fields {
+		if f.ignored {
+			continue
+		}
+
+		// Keys are looked up in dot notation, see canonicalValues,
+		// and in lower case if case-insensitive, see foldValues.
+		name := f.name
+		if d.ignoreCase {
+			name = f.fold
+		}
+		key := NestDot.join(prefix, name)
+		sub := key
+		if f.inline || d.nest == NestFlat {
+			sub = prefix
+		}
+		fieldPath := NestDot.join(path, f.fieldName)
+		leaf := d.isLeaf(f.unmarshal, f.typ)
 
-	for i := 0; i < t.NumField(); i++ {
-		name, _ := fieldAlias(t.Field(i))
-		if name == "-" {
-			fields[name] = false
+		st.fields[key] = true
+		fv := v.Field(f.index)
+
+		if f.file {
+			files, found := st.files[key]
+			if f.opts.Contains("required") && len(files) == 0 {
+				if err := d.fail(st, key, fieldPath, "", ErrRequired); err != nil {
+					return mapField, err
+				}
+				continue
+			}
+			if !found {
+				if !d.patch {
+					fv.Set(reflect.Zero(f.typ))
+				}
+				continue
+			}
+			st.touched++
+			if err := d.decodeFiles(fv, f.typ, key, fieldPath, files, st); err != nil {
+				return mapField, err
+			}
 			continue
 		}
 
-		fields[name] = true
-		fv := v.Field(i)
+		vals, found := src[key]
+		if d.arrayStyle != ArrayRepeat && !leaf && d.isValueSlice(&f) {
+			vals, found = d.arrayValues(st, key, vals, found)
+		}
 
-		if fv.CanAddr() && fv.Addr().Type().Implements(unmarshalerType) {
-			if err = fv.Addr().Interface().(Unmarshaler).UnmarshalURL(src.Get(name)); err != nil {
-				goto End
+		if f.opts.Contains("required") && !d.isPresent(&f, key, sub == prefix, src, vals) {
+			if err := d.fail(st, key, fieldPath, "", ErrRequired); err != nil {
+				return mapField, err
 			}
 			continue
 		}
 
-		switch fv.Type().Kind() {
-		case reflect.Ptr:
-			if src.Get(name) == NullValue {
-				fv.Set(reflect.Zero(fv.Type()))
+		if f.defaults != nil && !d.patch && !hasValue(vals) {
+			vals, found = f.defaults, true
+		}
+		value := ""
+		if len(vals) > 0 {
+			value = vals[0]
+		}
+		if found {
+			st.touched++
+		}
+		errs := len(st.errs)
+
+		switch {
+		case f.typ.Kind() == reflect.Ptr:
+			// Missing keys are not null, even if the null token is empty.
+			if found && value == d.nullValue {
+				fv.Set(reflect.Zero(f.typ))
+				continue
+			}
+			if !d.isStruct(f.unmarshal, f.typ) {
+				if !found {
+					if !d.patch {
+						fv.Set(reflect.Zero(f.typ))
+					}
+					continue
+				}
+				fv.Set(reflect.New(f.typ.Elem()))
+				if err := d.decodeElement(f.unmarshal, f.typ, fv, value, f.opts); err != nil {
+					if err = d.fail(st, key, fieldPath, value, err); err != nil {
+						return mapField, err
+					}
+					continue
+				}
+				break
+			}
+			// Keys of inlined pointers can't tell whether a recursive type goes on,
+			// so structs being decoded are not allocated again, e.g. Node.Next.
+			if sub != prefix && !hasKeyPrefix(src, key) || sub == prefix && st.types[f.typ.Elem()] > 0 {
+				if !d.patch {
+					fv.Set(reflect.Zero(f.typ))
+				}
 				continue
 			}
-			fv.Set(reflect.New(fv.Type().Elem()))
-			if fv.Type().Implements(unmarshalerType) {
-				err = fv.Interface().(Unmarshaler).UnmarshalURL(src.Get(name))
-			} else {
-				recursionField, err = d.decode(fv.Elem(), src, fields)
-			}
-		case reflect.Struct:
-			recursionField, err = d.decode(fv, src, fields)
-		case reflect.Slice, reflect.Array:
-			slice := reflect.MakeSlice(fv.Type(), len(src[name]), len(src[name]))
-			for j, s := range src[name] {
-				if err = d.decodeElement(fv.Type().Elem(), slice.Index(j), s); err != nil {
-					goto End
+			// In patch mode, a nil pointer is only kept allocated if any of its fields is set.
+			allocated := !d.patch || fv.IsNil()
+			if allocated {
+				fv.Set(reflect.New(f.typ.Elem()))
+			}
+			touched := st.touched
+			nested, err := d.decode(fv.Elem(), sub, fieldPath, st)
+			if err != nil {
+				return mapField, err
+			}
+			if d.patch && allocated && st.touched == touched {
+				fv.Set(reflect.Zero(f.typ))
+			}
+			if mapField == nil {
+				mapField = nested
+			}
+		case f.typ.Kind() == reflect.Struct && !leaf:
+			nested, err := d.decode(fv, sub, fieldPath, st)
+			if err != nil {
+				return mapField, err
+			}
+			if mapField == nil {
+				mapField = nested
+			}
+		case (f.typ.Kind() == reflect.Slice || f.typ.Kind() == reflect.Array) && !leaf:
+			if d.isStruct(f.elem.unmarshal, f.typ.Elem()) {
+				if err := d.decodeStructs(fv, key, fieldPath, st); err != nil {
+					return mapField, err
 				}
+				continue
+			}
+			if d.patch && !found {
+				continue
+			}
+			if err := d.decodeSlice(fv, &f, key, fieldPath, vals, st); err != nil {
+				return mapField, err
+			}
+		case f.typ.Kind() == reflect.Map && !leaf && f.inline:
+			if mapField == nil {
+				mapField = &inlineMap{fv, fieldPath}
+			}
+		case f.typ.Kind() == reflect.Map && !leaf:
+			n, err := d.decodeMapField(fv, key, fieldPath, f.opts, st)
+			if err != nil {
+				return mapField, err
+			}
+			if n > 0 {
+				found = true
+				st.touched++
 			}
-			fv.Set(slice)
-		case reflect.Map:
-			mapField = fv
 		default:
-			if err = d.unmarshal(fv.Type(), fv, src.Get(name)); err != nil {
-				goto End
+			if d.patch && !found {
+				continue
+			}
+			if err := d.decodeElement(f.unmarshal, f.typ, fv, value, f.opts); err != nil {
+				if err = d.fail(st, key, fieldPath, value, err); err != nil {
+					return mapField, err
+				}
+			}
+		}
+
+		// Rules are only checked on values decoded without errors.
+		if found && f.rules != nil && len(st.errs) == errs {
+			if err := d.validate(&f, fv, key, fieldPath, value, st); err != nil {
+				return mapField, err
 			}
 		}
 	}
 
-End:
-	if mapField.IsValid() {
-		return mapField, err
+	return mapField, nil
+}
+
+// isPresent reports whether any of the values vals of the field f is not empty,
+// or the form has any key nested in it if the field is a struct, a slice of structs
+// or a map. Inlined structs are always present.
+func (d *Decoder) isPresent(f *field, key string, inline bool, src url.Values, vals []string) bool {
+	if d.isStruct(f.unmarshal, f.typ) {
+		return inline || hasKeyPrefix(src, key)
+	}
+	if k := f.typ.Kind(); (k == reflect.Slice || k == reflect.Array) && !d.isLeaf(f.unmarshal, f.typ) &&
+		d.isStruct(f.elem.unmarshal, f.typ.Elem()) {
+		return hasKeyPrefix(src, key)
+	}
+	if f.typ.Kind() == reflect.Map && !d.isLeaf(f.unmarshal, f.typ) && !f.inline {
+		nested, _ := nestedValues(src, key)
+		return len(nested) > 0
+	}
+	return hasValue(vals)
+}
+
+// isValueSlice reports whether the field f is a slice or array of values, not of structs.
+func (d *Decoder) isValueSlice(f *field) bool {
+	k := f.typ.Kind()
+	return (k == reflect.Slice || k == reflect.Array) && !d.isStruct(f.elem.unmarshal, f.typ.Elem())
+}
+
+// arrayValues appends the values of the array keys of key in the array style of d,
+// e.g. ids[] or ids[0], to the values vals of key itself.
+func (d *Decoder) arrayValues(st *decodeState, key string, vals []string, found bool) ([]string, bool) {
+	// Bracket notation is converted into dot notation unless the nest style is NestFlat,
+	// e.g. ids[] to ids. and ids[0] to ids.0.
+	open, end := "[", "]"
+	if st.dotted {
+		open, end = ".", ""
+	}
+
+	if d.arrayStyle == ArrayBrackets {
+		k := key + open + end
+		st.fields[k] = true
+		if more, ok := st.src[k]; ok {
+			return append(vals[:len(vals):len(vals)], more...), true
+		}
+		return vals, found
+	}
+
+	for _, k := range indexedKeys(st.src, key, open, end) {
+		st.fields[k] = true
+		vals, found = append(vals[:len(vals):len(vals)], st.src[k]...), true
+	}
+	return vals, found
+}
+
+// hasValue reports whether any of vals is not empty.
+func hasValue(vals []string) bool {
+	for _, s := range vals {
+		if s != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSlice decodes the values vals into the slice or array v of the field f.
+func (d *Decoder) decodeSlice(v reflect.Value, f *field, key, path string, vals []string, st *decodeState) error {
+	if sep := d.sliceSeparator(f); sep != "" {
+		var split []string
+		for _, s := range vals {
+			if s != "" {
+				split = append(split, splitValue(s, sep)...)
+			}
+		}
+		vals = split
+	}
+	if f.typ.Kind() == reflect.Array {
+		v.Set(reflect.Zero(f.typ))
+		if len(vals) > v.Len() {
+			err := fmt.Errorf("index %d out of range [0:%d]", len(vals)-1, v.Len())
+			return d.fail(st, key, path, "", err)
+		}
+	} else {
+		v.Set(reflect.MakeSlice(f.typ, len(vals), len(vals)))
+	}
+
+	for i, s := range vals {
+		if err := d.decodeElement(f.elem.unmarshal, f.typ.Elem(), v.Index(i), s, f.opts); err != nil {
+			if err = d.fail(st, key, fmt.Sprintf("%s[%d]", path, i), s, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// decodeStructs decodes indexed keys, e.g. items.0.name, into the slice or array of structs v.
+func (d *Decoder) decodeStructs(v reflect.Value, key, path string, st *decodeState) error {
+	// In flat mode, elements are decoded from the keys nested in key, converted
+	// into dot notation, e.g. items.0.name for items[0][name] or items[0].name.
+	if !st.dotted {
+		nested, consumed := nestedValues(st.src, key)
+		src := st.src
+		st.src, st.dotted = nested, true
+		defer func() {
+			st.src, st.dotted = src, false
+			for _, k := range consumed {
+				if st.fields[canonicalKey(k)] {
+					st.fields[k] = true
+				}
+			}
+		}()
+	}
+
+	indices := keyIndices(st.src, key)
+	size := 0
+	if len(indices) > 0 {
+		// Indices are compared before adding 1, which may overflow.
+		last := indices[len(indices)-1]
+		if last > d.maxIndex {
+			err := fmt.Errorf("index %d exceeds the maximum %d", last, d.maxIndex)
+			return d.fail(st, key, path, "", err)
+		}
+		size = last + 1
+	}
+
+	t := v.Type()
+	switch {
+	case t.Kind() == reflect.Array && size > t.Len():
+		err := fmt.Errorf("index %d out of range [0:%d]", size-1, t.Len())
+		return d.fail(st, key, path, "", err)
+	case d.patch && len(indices) == 0:
+		return nil
+	case d.patch && t.Kind() == reflect.Slice && size > v.Len():
+		// Existing elements are patched in place, the slice is only grown.
+		slice := reflect.MakeSlice(t, size, size)
+		reflect.Copy(slice, v)
+		v.Set(slice)
+	case d.patch:
+	case t.Kind() == reflect.Array:
+		v.Set(reflect.Zero(t))
+	default:
+		v.Set(reflect.MakeSlice(t, size, size))
+	}
+	if len(indices) > 0 {
+		st.touched++
 	}
-	return recursionField, err
+
+	for _, i := range indices {
+		ev, sub := v.Index(i), NestDot.index(key, i)
+		if ev.Kind() == reflect.Ptr {
+			st.fields[sub] = true
+			if vals := st.src[sub]; len(vals) > 0 && vals[0] == d.nullValue {
+				ev.Set(reflect.Zero(ev.Type()))
+				continue
+			}
+			if ev.IsNil() {
+				ev.Set(reflect.New(t.Elem().Elem()))
+			}
+			ev = ev.Elem()
+		}
+		if _, err := d.decode(ev, sub, fmt.Sprintf("%s[%d]", path, i), st); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (d *Decoder) unmarshal(t reflect.Type, v reflect.Value, src string) (err error) {
@@ -1,9 +1,13 @@
 package form
 
 import (
+	"encoding"
 	"fmt"
 	"net/url"
 	"reflect"
+	"sort"
+	"strconv"
+	"time"
 )
 
 type Marshaler interface {
@@ -15,12 +19,33 @@ var (
 )
 
 type Encoder struct {
-	values url.Values
+	options
+	out        sink
+	nest       NestStyle
+	timeLayout string
+	converters map[reflect.Type]func(reflect.Value) (string, error)
+	noText     bool
+	skip       []string
+	maxDepth   int
+
+	// State of the current Encode call.
+	depth int
+	seen  map[visit]bool // pointers being encoded
+}
+
+// visit is a pointer being encoded. Types are compared as well,
+// since a struct and its first field share the same address.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
 }
 
-func NewEncoder(dst url.Values) *Encoder {
+func NewEncoder(dst url.Values, opts ...Option) *Encoder {
 	return &Encoder{
-		values: dst,
+		options:    newOptions(opts),
+		out:        valuesSink(dst),
+		timeLayout: time.RFC3339,
+		maxDepth:   DefaultMaxDepth,
 	}
 }
 
@@ -30,15 +55,106 @@ func (e *Encoder) Encode(src interface{}) error {
 		return TypeError
 	}
 
-	err := e.encode(v.Elem(), e.values)
+	e.depth, e.seen = 0, nil
+	e.enter(v, "")
+	err := e.encode(v.Elem(), "")
 	return err
 }
 
+// SetMaxDepth sets the maximum depth of nested structs and maps, DefaultMaxDepth by default.
+// Deeper values fail with a *DepthError, like pointers referring to a value being encoded.
+func (e *Encoder) SetMaxDepth(n int) {
+	e.maxDepth = n
+}
+
+// enter records the non-nil pointer v as being encoded with the key,
+// and fails if it already is, i.e. if v refers to itself.
+func (e *Encoder) enter(v reflect.Value, key string) error {
+	p := visit{v.Pointer(), v.Type()}
+	if e.seen[p] {
+		return &DepthError{
+			Key:   key,
+			Type:  v.Type(),
+			Cycle: true,
+		}
+	}
+	if e.seen == nil {
+		e.seen = map[visit]bool{}
+	}
+	e.seen[p] = true
+	return nil
+}
+
+// leave removes the pointer v recorded by enter.
+func (e *Encoder) leave(v reflect.Value) {
+	delete(e.seen, visit{v.Pointer(), v.Type()})
+}
+
+// descend increases the depth of nested values, and fails beyond the maximum depth.
+func (e *Encoder) descend(t reflect.Type, key string) error {
+	if e.depth++; e.maxDepth > 0 && e.depth > e.maxDepth {
+		return &DepthError{
+			Key:   key,
+			Type:  t,
+			Depth: e.maxDepth,
+		}
+	}
+	return nil
+}
+
+// SetNestStyle sets the way keys of nested struct fields are built, NestFlat by default.
+func (e *Encoder) SetNestStyle(s NestStyle) {
+	e.nest = s
+}
+
+// SetTimeLayout sets the layout of time.Time fields without a layout option,
+// time.RFC3339 by default. UnixLayout and UnixMilliLayout are accepted as well.
+func (e *Encoder) SetTimeLayout(layout string) {
+	e.timeLayout = layout
+}
+
+// RegisterConverter registers fn to encode values of type t.
+// Converters are used when t implements neither Marshaler nor a pointer to it does,
+// and take precedence over the built-in conversions.
+func (e *Encoder) RegisterConverter(t reflect.Type, fn func(reflect.Value) (string, error)) {
+	if e.converters == nil {
+		e.converters = map[reflect.Type]func(reflect.Value) (string, error){}
+	}
+	e.converters[t] = fn
+}
+
+// DisableTextMarshaler stops falling back to encoding.TextMarshaler for types
+// implementing neither Marshaler nor a registered converter.
+func (e *Encoder) DisableTextMarshaler() {
+	e.noText = true
+}
+
+// SkipTagOption skips the fields tagged with option, e.g. nosign.
+func (e *Encoder) SkipTagOption(option string) {
+	e.skip = append(e.skip, option)
+}
+
+// skipped reports whether the field f is tagged with any of the skipped options.
+func (e *Encoder) skipped(f *field) bool {
+	for _, opt := range e.skip {
+		if f.opts.Contains(opt) {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *Encoder) isZero(v reflect.Value) bool {
 	switch v.Kind() {
 	case reflect.Func:
-	case reflect.Map, reflect.Slice, reflect.Array:
+	case reflect.Map, reflect.Slice:
 		return v.IsNil() || v.Len() == 0
+	case reflect.Array:
+		z := true
+		for i := 0; i < v.Len(); i++ {
+			z = z && e.isZero(v.Index(i))
+		}
+		return z
 	case reflect.Struct:
 		z := true
 		for i := 0; i < v.NumField(); i++ {
@@ -47,92 +163,321 @@ func (e *Encoder) isZero(v reflect.Value) bool {
 		return z
 	}
 	// Compare other types directly:
-	z := reflect.Zero(v.Type())
-	return v.Interface() == z.Interface()
+	return v.IsZero()
 }
 
-func (e *Encoder) encode(v reflect.Value, dst url.Values) error {
-	var (
-		marshaler Marshaler
-	)
-
-	t := v.Type()
+func (e *Encoder) encode(v reflect.Value, prefix string) error {
+	defer func() {
+		e.depth--
+	}()
+	if err := e.descend(v.Type(), prefix); err != nil {
+		return err
+	}
 
-	for i := 0; i < v.NumField(); i++ {
-		name, opts := fieldAlias(t.Field(i))
-		if name == "-" {
+	for _, f := range cachedPlan(v.Type(), &e.options).fields {
+		if f.ignored || e.skipped(&f) {
 			continue
 		}
 
-		fv := v.Field(i)
-		if opts.Contains("omitempty") && e.isZero(fv) {
+		key := e.nest.join(prefix, f.name)
+		sub := key
+		if f.inline || e.nest == NestFlat {
+			sub = prefix
+		}
+
+		fv := v.Field(f.index)
+		if f.opts.Contains("omitempty") && e.isZero(fv) {
 			continue
 		}
 
+		if f.upload {
+			if files, ok := e.out.(fileSink); ok {
+				if err := e.encodeFile(files, &f, fv, key); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
 		// Encode base types and custom implementations immediately.
-		marshaler = e.getMarshaler(fv.Type(), fv)
-		if marshaler != nil {
+		if marshaler := e.getMarshaler(f.marshal, f.typ, fv, f.opts); marshaler != nil {
 			value, err := marshaler.MarshalURL()
 			if err != nil {
 				return err
 			}
-			dst[name] = append(dst[name], value)
+			if err = e.out.add(key, value); err != nil {
+				return err
+			}
 			continue
 		}
 
-		switch fv.Type().Kind() {
+		switch f.typ.Kind() {
 		case reflect.Ptr:
-			if !fv.IsValid() || fv.IsNil() {
-				dst[name] = []string{NullValue}
-				continue
+			if !e.isStruct(f.marshal, f.typ) {
+				return fmt.Errorf("marshaler not found for %v", f.typ)
+			}
+			if err := e.enter(fv, key); err != nil {
+				return err
 			}
-			if err := e.encode(fv.Elem(), dst); err != nil {
+			if err := e.encode(fv.Elem(), sub); err != nil {
 				return err
 			}
+			e.leave(fv)
 		case reflect.Struct:
-			err := e.encode(fv, dst)
+			err := e.encode(fv, sub)
 			if err != nil {
 				return err
 			}
 		case reflect.Slice, reflect.Array:
-			dst[name] = []string{}
-			for j := 0; j < fv.Len(); j++ {
-				value, err := e.getMarshaler(fv.Type().Elem(), fv.Index(j)).MarshalURL()
-				if err != nil {
+			if e.isStruct(f.elem.marshal, f.typ.Elem()) {
+				if err := e.encodeStructs(fv, key); err != nil {
 					return err
 				}
-				dst[name] = append(dst[name], value)
+				continue
+			}
+			if err := e.encodeSlice(&f, fv, key); err != nil {
+				return err
 			}
 		case reflect.Map:
-			for _, k := range fv.MapKeys() {
-				key, err := e.getMarshaler(k.Type(), k).MarshalURL()
-				if err != nil {
-					return err
-				}
-				value, err := e.getMarshaler(fv.MapIndex(k).Type(), fv.MapIndex(k)).MarshalURL()
-				if err != nil {
-					return err
-				}
-				dst[key] = append(dst[key], value)
+			// Entries of inline maps are spilled into the top level.
+			if f.inline {
+				key = ""
+			}
+			if err := e.encodeMap(fv, key, f.opts); err != nil {
+				return err
 			}
 		default:
-			return fmt.Errorf("marshaler not found for %v", fv.Type())
+			return fmt.Errorf("marshaler not found for %v", f.typ)
+		}
+	}
+
+	return nil
+}
+
+// isLeaf reports whether values of type t, with marshal strategy s, are encoded as a single form value.
+func (e *Encoder) isLeaf(s strategy, t reflect.Type) bool {
+	if e.converters[t] != nil {
+		return true
+	}
+	if s.text() {
+		return !e.noText
+	}
+	return s != strategyNone
+}
+
+// isStruct reports whether t, or the type t points to, is a struct encoded field by field.
+// s is the marshal strategy of t.
+func (e *Encoder) isStruct(s strategy, t reflect.Type) bool {
+	if e.isLeaf(s, t) {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if e.isLeaf(cachedCodec(t).marshal, t) {
+			return false
+		}
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// encodeSlice encodes the slice or array v of the field f, either as repeated values
+// or joined into a single value with the separator.
+func (e *Encoder) encodeSlice(f *field, v reflect.Value, key string) error {
+	if e.arrayStyle == ArrayRepeat || e.sliceSeparator(f) != "" {
+		e.out.clear(key)
+	}
+	values := make([]string, 0, v.Len())
+	for j := 0; j < v.Len(); j++ {
+		marshaler := e.getMarshaler(f.elem.marshal, f.typ.Elem(), v.Index(j), f.opts)
+		if marshaler == nil {
+			return fmt.Errorf("marshaler not found for %v", f.typ.Elem())
+		}
+		value, err := marshaler.MarshalURL()
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+	}
+	sep := e.sliceSeparator(f)
+	if sep != "" && len(values) > 0 {
+		values = []string{joinValues(values, sep)}
+	}
+	for i, value := range values {
+		k := key
+		switch {
+		case sep != "":
+		case e.arrayStyle == ArrayBrackets:
+			k += "[]"
+		case e.arrayStyle == ArrayIndex:
+			k += "[" + strconv.Itoa(i) + "]"
+		}
+		if err := e.out.add(k, value); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
+// encodeMap encodes the entries of the map v with keys nested in key,
+// e.g. meta.color or meta[color], sorted by key. Entries are not nested
+// if key is empty.
+func (e *Encoder) encodeMap(v reflect.Value, key string, opts tagOptions) error {
+	t := v.Type()
+	defer func() {
+		e.depth--
+	}()
+	if err := e.descend(t, key); err != nil {
+		return err
+	}
+
+	kc := cachedCodec(t.Key())
+	keys := make([]string, 0, v.Len())
+	entries := make(map[string]reflect.Value, v.Len())
+	for _, k := range v.MapKeys() {
+		marshaler := e.getMarshaler(kc.marshal, t.Key(), k, opts)
+		if marshaler == nil {
+			return fmt.Errorf("marshaler not found for %v", t.Key())
+		}
+		name, err := marshaler.MarshalURL()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, name)
+		entries[name] = v.MapIndex(k)
+	}
+	sort.Strings(keys)
+
+	for _, name := range keys {
+		// Map values are copied to be addressable, see strategyAddr.
+		ev := reflect.New(t.Elem()).Elem()
+		ev.Set(entries[name])
+		if err := e.encodeMapValue(ev, e.nest.join(key, name), opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeMapValue encodes the map entry v with the key, and the keys nested in it
+// if v is a struct, a map or a slice.
+func (e *Encoder) encodeMapValue(v reflect.Value, key string, opts tagOptions) error {
+	t := v.Type()
+	s := cachedCodec(t).marshal
+	switch {
+	case e.isLeaf(s, t):
+	case t.Kind() == reflect.Ptr && !v.IsNil():
+		if err := e.enter(v, key); err != nil {
+			return err
+		}
+		if err := e.encodeMapValue(v.Elem(), key, opts); err != nil {
+			return err
+		}
+		e.leave(v)
+		return nil
+	case t.Kind() == reflect.Struct:
+		return e.encode(v, key)
+	case t.Kind() == reflect.Map:
+		return e.encodeMap(v, key, opts)
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && e.isStruct(cachedCodec(t.Elem()).marshal, t.Elem()):
+		return e.encodeStructs(v, key)
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		f := &field{
+			codec: codec{marshal: s},
+			opts:  opts,
+			typ:   t,
+			elem:  cachedCodec(t.Elem()),
+			sep:   sepOption(opts),
+		}
+		return e.encodeSlice(f, v, key)
+	}
+
+	marshaler := e.getMarshaler(s, t, v, opts)
+	if marshaler == nil {
+		return fmt.Errorf("marshaler not found for %v", t)
+	}
+	value, err := marshaler.MarshalURL()
+	if err != nil {
+		return err
+	}
+	return e.out.add(key, value)
+}
+
+// encodeStructs encodes the slice or array of structs v with indexed keys, e.g. items.0.name.
+func (e *Encoder) encodeStructs(v reflect.Value, key string) error {
+	for i := 0; i < v.Len(); i++ {
+		ev := v.Index(i)
+		if ev.Kind() == reflect.Ptr {
+			if ev.IsNil() {
+				if err := e.out.add(e.nest.index(key, i), e.nullValue); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := e.enter(ev, e.nest.index(key, i)); err != nil {
+				return err
+			}
+			if err := e.encode(ev.Elem(), e.nest.index(key, i)); err != nil {
+				return err
+			}
+			e.leave(ev)
+			continue
+		}
+		if err := e.encode(ev, e.nest.index(key, i)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (e *Encoder) getMarshaler(t reflect.Type, v reflect.Value) Marshaler {
-	if v.CanAddr() && v.Addr().Type().Implements(marshalerType) {
-		return v.Addr().Interface().(Marshaler)
-	} else if v.Type().Implements(marshalerType) {
-		if v.Type().Kind() != reflect.Ptr || v.IsValid() && !v.IsNil() {
+// getMarshaler returns the Marshaler of v according to the precomputed strategy s,
+// or nil if v must be walked recursively.
+func (e *Encoder) getMarshaler(s strategy, t reflect.Type, v reflect.Value, opts tagOptions) Marshaler {
+	// Precedence: Marshaler, converters, time types, encoding.TextMarshaler and built-in kinds.
+	switch s {
+	case strategyValue:
+		if t.Kind() != reflect.Ptr || !v.IsNil() {
 			return v.Interface().(Marshaler)
 		}
+	case strategyAddr:
+		if v.CanAddr() {
+			return v.Addr().Interface().(Marshaler)
+		}
+	}
+
+	if fn, ok := e.converters[t]; ok {
+		return &converter{
+			fn:  fn,
+			val: v,
+		}
+	}
+
+	if s == strategyTime {
+		if t == stdDurationType {
+			return Duration(v.Int())
+		}
+		return Time{
+			Time:   v.Interface().(time.Time),
+			Layout: timeLayout(opts, e.timeLayout),
+		}
+	}
+
+	if !e.noText {
+		switch s {
+		case strategyTextValue:
+			return textMarshaler{v.Interface().(encoding.TextMarshaler)}
+		case strategyTextAddr:
+			if v.CanAddr() {
+				return textMarshaler{v.Addr().Interface().(encoding.TextMarshaler)}
+			}
+		}
 	}
 
 	switch t.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return String(e.nullValue)
+		}
+		return e.getMarshaler(cachedCodec(t.Elem()).marshal, t.Elem(), v.Elem(), opts)
 	case reflect.Bool:
 		val := reflect.New(BoolType).Elem()
 		val.SetBool(v.Bool())
@@ -169,3 +514,43 @@ func (e *Encoder) getMarshaler(t reflect.Type, v reflect.Value) Marshaler {
 		return nil
 	}
 }
+
+// sink receives the key/value pairs produced by an Encoder.
+type sink interface {
+	// add appends value to the values of key.
+	add(key, value string) error
+	// clear marks key as present without any value, e.g. for empty slices.
+	clear(key string)
+}
+
+// valuesSink writes into url.Values.
+type valuesSink url.Values
+
+func (s valuesSink) add(key, value string) error {
+	s[key] = append(s[key], value)
+	return nil
+}
+
+func (s valuesSink) clear(key string) {
+	s[key] = []string{}
+}
+
+// converter adapts a registered converter function to Marshaler.
+type converter struct {
+	fn  func(reflect.Value) (string, error)
+	val reflect.Value
+}
+
+func (c *converter) MarshalURL() (string, error) {
+	return c.fn(c.val)
+}
+
+// textMarshaler adapts encoding.TextMarshaler to Marshaler.
+type textMarshaler struct {
+	encoding.TextMarshaler
+}
+
+func (m textMarshaler) MarshalURL() (string, error) {
+	b, err := m.MarshalText()
+	return string(b), err
+}
@@ -0,0 +1,79 @@
+package form
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	// ErrRequired is the cause of a DecodeError for a required key missing in the form.
+	ErrRequired = errors.New("required key is missing")
+	// ErrUnknownKey is the cause of a DecodeError for a key not bound to any field.
+	ErrUnknownKey = errors.New("unknown key")
+)
+
+// DepthError describes a value nested deeper than the maximum depth,
+// or a pointer referring to a value being encoded.
+type DepthError struct {
+	Key   string       // form key of the value, e.g. node.next.next
+	Type  reflect.Type // type of the value
+	Depth int          // maximum depth
+	Cycle bool         // whether the value is a pointer cycle
+}
+
+func (e *DepthError) Error() string {
+	if e.Cycle {
+		return fmt.Sprintf("form: pointer cycle at key %q of type %v", e.Key, e.Type)
+	}
+	return fmt.Sprintf("form: key %q of type %v exceeds the maximum depth %d", e.Key, e.Type, e.Depth)
+}
+
+// ErrorMode is the way a Decoder reacts to decoding failures.
+type ErrorMode int
+
+const (
+	// StopOnError stops decoding at the first failure and returns its *DecodeError.
+	StopOnError ErrorMode = iota
+	// CollectErrors keeps decoding and returns all failures as a MultiError.
+	CollectErrors
+)
+
+// DecodeError describes a form value which cannot be decoded into a struct field.
+type DecodeError struct {
+	Key   string // form key, e.g. addr.city
+	Field string // struct field path, e.g. Addr.City
+	Value string // raw form value
+	Err   error  // underlying error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("form: decode key %q: %v", e.Key, e.Err)
+	}
+	return fmt.Sprintf("form: decode key %q into field %s: %v", e.Key, e.Field, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError is the list of failures collected in CollectErrors mode.
+type MultiError []error
+
+func (m MultiError) Error() string {
+	switch len(m) {
+	case 0:
+		return "form: no errors"
+	case 1:
+		return m[0].Error()
+	}
+
+	s := make([]string, 0, len(m))
+	for _, err := range m {
+		s = append(s, err.Error())
+	}
+	return fmt.Sprintf("form: %d errors: %s", len(m), strings.Join(s, "; "))
+}
@@ -9,12 +9,12 @@ var (
 	TypeError = errors.New("the interface must be a pointer to a struct")
 )
 
-func Marshal(src interface{}) (url.Values, error) {
+func Marshal(src interface{}, opts ...Option) (url.Values, error) {
 	v := url.Values{}
-	err := NewEncoder(v).Encode(src)
+	err := NewEncoder(v, opts...).Encode(src)
 	return v, err
 }
 
-func Unmarshal(dst interface{}, src url.Values) error {
-	return NewDecoder(src).Decode(dst)
+func Unmarshal(dst interface{}, src url.Values, opts ...Option) error {
+	return NewDecoder(src, opts...).Decode(dst)
 }
@@ -1,11 +1,21 @@
 package form
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -15,7 +25,7 @@ func TestBaseType(t *testing.T) {
 		BV bool `form:"b_v,omitempty"`
 		UV uint
 		SV []int          `form:"s_v"`
-		MV map[int]string `form:"m_v"`
+		MV map[int]string `form:"m_v,inline"`
 		EX []string       `form:"-"`
 	}
 
@@ -657,7 +667,7 @@ func TestComplex(t *testing.T) {
 
 func TestMap(t *testing.T) {
 	type TestType struct {
-		M map[int]int
+		M map[int]int `form:",inline"`
 	}
 
 	exp := url.Values{
@@ -694,3 +704,1594 @@ func TestMap(t *testing.T) {
 		t.Fatal("invalid decode result:", v2, "expected:", v1)
 	}
 }
+
+func TestNestStyle(t *testing.T) {
+	type Address struct {
+		Name string `form:"name"`
+		City string `form:"city"`
+	}
+	type Embed struct {
+		ID int `form:"id"`
+	}
+	type TestType struct {
+		Embed
+		Name string   `form:"name"`
+		Addr Address  `form:"addr"`
+		Work *Address `form:"work"`
+		Prev *Address `form:"prev"`
+	}
+
+	v1 := TestType{
+		Embed: Embed{ID: 1},
+		Name:  "n",
+		Addr:  Address{Name: "home", City: "a"},
+		Work:  &Address{Name: "office", City: "b"},
+	}
+
+	for style, exp := range map[NestStyle]url.Values{
+		NestDot: {
+			"id":        []string{"1"},
+			"name":      []string{"n"},
+			"addr.name": []string{"home"},
+			"addr.city": []string{"a"},
+			"work.name": []string{"office"},
+			"work.city": []string{"b"},
+			"prev":      []string{"null"},
+		},
+		NestBracket: {
+			"id":         []string{"1"},
+			"name":       []string{"n"},
+			"addr[name]": []string{"home"},
+			"addr[city]": []string{"a"},
+			"work[name]": []string{"office"},
+			"work[city]": []string{"b"},
+			"prev":       []string{"null"},
+		},
+	} {
+		// Marshal
+		val := url.Values{}
+		enc := NewEncoder(val)
+		enc.SetNestStyle(style)
+		if err := enc.Encode(&v1); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(val, exp) {
+			t.Fatal("invalid encode result:", val, "expected:", exp)
+		}
+
+		// Unmarshal
+		v2 := TestType{}
+		dec := NewDecoder(exp)
+		dec.SetNestStyle(style)
+		if err := dec.Decode(&v2); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v1, v2) {
+			t.Fatal("invalid decode result:", v2, "expected:", v1)
+		}
+	}
+
+	// Mixed notations
+	v2 := TestType{}
+	dec := NewDecoder(url.Values{
+		"addr[city]": []string{"a"},
+		"work.city":  []string{"b"},
+	})
+	dec.SetNestStyle(NestBracket)
+	if err := dec.Decode(&v2); err != nil {
+		t.Fatal(err)
+	}
+	if v2.Addr.City != "a" || v2.Work == nil || v2.Work.City != "b" || v2.Prev != nil {
+		t.Fatal("invalid decode result:", v2)
+	}
+}
+
+func TestStructSlice(t *testing.T) {
+	type Item struct {
+		Name string `form:"name"`
+	}
+	type TestType struct {
+		Items []Item  `form:"items"`
+		Ptrs  []*Item `form:"ptrs"`
+		Array [2]Item `form:"array"`
+	}
+
+	v1 := TestType{
+		Items: []Item{{Name: "a"}, {Name: "b"}},
+		Ptrs:  []*Item{{Name: "c"}, nil},
+		Array: [2]Item{{Name: "d"}},
+	}
+	exp := url.Values{
+		"items.0.name": []string{"a"},
+		"items.1.name": []string{"b"},
+		"ptrs.0.name":  []string{"c"},
+		"ptrs.1":       []string{"null"},
+		"array.0.name": []string{"d"},
+		"array.1.name": []string{""},
+	}
+
+	// Marshal
+	val, err := Marshal(&v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(val, exp) {
+		t.Fatal("invalid encode result:", val, "expected:", exp)
+	}
+
+	// Unmarshal
+	v2 := TestType{}
+	err = Unmarshal(&v2, exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v1, v2) {
+		t.Fatal("invalid decode result:", v2, "expected:", v1)
+	}
+
+	// Bracket notation with sparse indices
+	v2 = TestType{}
+	dec := NewDecoder(url.Values{
+		"items[0][name]": []string{"a"},
+		"items[2].name":  []string{"c"},
+	})
+	dec.SetNestStyle(NestBracket)
+	if err = dec.Decode(&v2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v2.Items, []Item{{Name: "a"}, {}, {Name: "c"}}) {
+		t.Fatal("invalid decode result:", v2)
+	}
+
+	// Both notations are accepted in flat mode
+	v2 = TestType{}
+	dec = NewDecoder(url.Values{
+		"items[0].name":  []string{"a"},
+		"items[1][name]": []string{"b"},
+		"ptrs[0][name]":  []string{"c"},
+		"ptrs[1]":        []string{"null"},
+	})
+	dec.DisallowUnknownKeys()
+	if err = dec.Decode(&v2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v2.Items, v1.Items) || !reflect.DeepEqual(v2.Ptrs, v1.Ptrs) {
+		t.Fatal("invalid decode result:", v2)
+	}
+	dec = NewDecoder(url.Values{"items[0][other]": []string{"a"}})
+	dec.DisallowUnknownKeys()
+	if err = dec.Decode(&v2); !errors.Is(err, ErrUnknownKey) {
+		t.Fatal("expected unknown key error, returns:", err)
+	}
+
+	// Index limits
+	dec = NewDecoder(url.Values{"items.11.name": []string{"a"}})
+	dec.SetMaxIndex(10)
+	if err = dec.Decode(&v2); err == nil {
+		t.Fatal("expected err")
+	}
+	if err = Unmarshal(&v2, url.Values{"array.2.name": []string{"a"}}); err == nil {
+		t.Fatal("expected err")
+	}
+	for _, nest := range []NestStyle{NestFlat, NestDot} {
+		dec = NewDecoder(url.Values{"items.9223372036854775807.name": []string{"a"}})
+		dec.SetNestStyle(nest)
+		if err = dec.Decode(&v2); err == nil {
+			t.Fatal("expected err")
+		}
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	type Address struct {
+		Zip int `form:"zip"`
+	}
+	type TestType struct {
+		Age  int     `form:"age"`
+		IDs  []int   `form:"ids"`
+		Addr Address `form:"addr"`
+	}
+
+	src := url.Values{
+		"age":      []string{"a"},
+		"ids":      []string{"1", "b"},
+		"addr.zip": []string{"c"},
+	}
+
+	// Stop on error
+	v := TestType{}
+	dec := NewDecoder(src)
+	dec.SetNestStyle(NestDot)
+	err := dec.Decode(&v)
+	de, ok := err.(*DecodeError)
+	if !ok {
+		t.Fatal("expected *DecodeError, returns:", err)
+	}
+	if de.Key != "age" || de.Field != "Age" || de.Value != "a" || de.Err == nil {
+		t.Fatal("invalid decode error:", de)
+	}
+
+	// Collect errors
+	dec.SetErrorMode(CollectErrors)
+	err = dec.Decode(&v)
+	me, ok := err.(MultiError)
+	if !ok || len(me) != 3 {
+		t.Fatal("expected 3 errors, returns:", err)
+	}
+	exp := [][2]string{{"age", "Age"}, {"ids", "IDs[1]"}, {"addr.zip", "Addr.Zip"}}
+	for i, err := range me {
+		de := err.(*DecodeError)
+		if de.Key != exp[i][0] || de.Field != exp[i][1] {
+			t.Fatal("invalid decode error:", de, "expected:", exp[i])
+		}
+	}
+	if v.IDs[0] != 1 {
+		t.Fatal("invalid decode result:", v)
+	}
+}
+
+func TestConverter(t *testing.T) {
+	type TestType struct {
+		Date  time.Time   `form:"date"`
+		Ptr   *time.Time  `form:"ptr"`
+		Dates []time.Time `form:"dates"`
+		Nil   *time.Time  `form:"nil"`
+	}
+
+	timeType := reflect.TypeOf(time.Time{})
+	encode := func(v reflect.Value) (string, error) {
+		return v.Interface().(time.Time).Format("2006-01-02"), nil
+	}
+	decode := func(s string) (reflect.Value, error) {
+		dt, err := time.Parse("2006-01-02", s)
+		return reflect.ValueOf(dt), err
+	}
+
+	day := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	v1 := TestType{
+		Date:  day,
+		Ptr:   &day,
+		Dates: []time.Time{day, day.AddDate(0, 0, 1)},
+	}
+	exp := url.Values{
+		"date":  []string{"2020-01-02"},
+		"ptr":   []string{"2020-01-02"},
+		"dates": []string{"2020-01-02", "2020-01-03"},
+		"nil":   []string{"null"},
+	}
+
+	// Marshal
+	val := url.Values{}
+	enc := NewEncoder(val)
+	enc.RegisterConverter(timeType, encode)
+	if err := enc.Encode(&v1); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(val, exp) {
+		t.Fatal("invalid encode result:", val, "expected:", exp)
+	}
+
+	// Unmarshal
+	v2 := TestType{}
+	dec := NewDecoder(exp)
+	dec.RegisterConverter(timeType, decode)
+	if err := dec.Decode(&v2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v1, v2) {
+		t.Fatal("invalid decode result:", v2, "expected:", v1)
+	}
+
+	// Converter errors
+	dec = NewDecoder(url.Values{"date": []string{"a"}})
+	dec.RegisterConverter(timeType, decode)
+	if err := dec.Decode(&v2); err == nil {
+		t.Fatal("expected err")
+	}
+}
+
+func TestTimeType(t *testing.T) {
+	type TestType struct {
+		Default   time.Time     `form:"default"`
+		Date      time.Time     `form:"date,layout=2006-01-02"`
+		Unix      time.Time     `form:"unix,unix"`
+		UnixMilli *time.Time    `form:"unix_milli,unixmilli"`
+		Empty     *time.Time    `form:"empty,omitempty"`
+		Timeout   time.Duration `form:"timeout"`
+		Dates     []time.Time   `form:"dates,layout=20060102"`
+	}
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	day := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	milli := now.Local()
+	v1 := TestType{
+		Default:   now.Truncate(time.Second),
+		Date:      day,
+		Unix:      now.Truncate(time.Second).Local(),
+		UnixMilli: &milli,
+		Timeout:   time.Minute,
+		Dates:     []time.Time{day},
+	}
+	exp := url.Values{
+		"default":    []string{"2020-01-02T03:04:05Z"},
+		"date":       []string{"2020-01-02"},
+		"unix":       []string{"1577934245"},
+		"unix_milli": []string{"1577934245006"},
+		"timeout":    []string{"1m0s"},
+		"dates":      []string{"20200102"},
+	}
+
+	// Marshal
+	val, err := Marshal(&v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(val, exp) {
+		t.Fatal("invalid encode result:", val, "expected:", exp)
+	}
+
+	// Unmarshal
+	v2 := TestType{}
+	err = Unmarshal(&v2, exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v1, v2) {
+		t.Fatal("invalid decode result:", v2, "expected:", v1)
+	}
+
+	// Default layout
+	val = url.Values{}
+	enc := NewEncoder(val)
+	enc.SetTimeLayout(UnixLayout)
+	if err = enc.Encode(&v1); err != nil {
+		t.Fatal(err)
+	}
+	if val.Get("default") != "1577934245" || val.Get("date") != "2020-01-02" {
+		t.Fatal("invalid encode result:", val)
+	}
+
+	// Invalid values
+	if err = Unmarshal(&v2, url.Values{"date": []string{"2020"}}); err == nil {
+		t.Fatal("expected err")
+	}
+	if err = Unmarshal(&v2, url.Values{"timeout": []string{"1"}}); err == nil {
+		t.Fatal("expected err")
+	}
+}
+
+type TextLevel int
+
+func (l TextLevel) MarshalText() ([]byte, error) {
+	if l > 0 {
+		return []byte("high"), nil
+	}
+	return []byte("low"), nil
+}
+
+func (l *TextLevel) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "high":
+		*l = 1
+	case "low":
+		*l = 0
+	default:
+		return errors.New("invalid level")
+	}
+	return nil
+}
+
+func TestTextMarshalerType(t *testing.T) {
+	type TestType struct {
+		IP    net.IP    `form:"ip"`
+		IPs   []net.IP  `form:"ips"`
+		Int   *big.Int  `form:"int"`
+		Level TextLevel `form:"level"`
+	}
+
+	v1 := TestType{
+		IP:    net.ParseIP("127.0.0.1"),
+		IPs:   []net.IP{net.ParseIP("::1")},
+		Int:   big.NewInt(42),
+		Level: 1,
+	}
+	exp := url.Values{
+		"ip":    []string{"127.0.0.1"},
+		"ips":   []string{"::1"},
+		"int":   []string{"42"},
+		"level": []string{"high"},
+	}
+
+	// Marshal
+	val, err := Marshal(&v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(val, exp) {
+		t.Fatal("invalid encode result:", val, "expected:", exp)
+	}
+
+	// Unmarshal
+	v2 := TestType{}
+	err = Unmarshal(&v2, exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v1.IP.Equal(v2.IP) || !v1.IPs[0].Equal(v2.IPs[0]) || v1.Int.Cmp(v2.Int) != 0 || v1.Level != v2.Level {
+		t.Fatal("invalid decode result:", v2, "expected:", v1)
+	}
+	if err = Unmarshal(&v2, url.Values{"level": []string{"medium"}}); err == nil {
+		t.Fatal("expected err")
+	}
+
+	// Missing keys reset values, unless in patch mode
+	type ResetType struct {
+		IP    net.IP    `form:"ip"`
+		Level TextLevel `form:"level"`
+		Port  int       `form:"port"`
+	}
+	v4 := ResetType{IP: net.IP{1, 2, 3, 4}, Level: 1, Port: 80}
+	dec := NewDecoder(url.Values{})
+	dec.SetPatchMode(true)
+	if err = dec.Decode(&v4); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v4, ResetType{IP: net.IP{1, 2, 3, 4}, Level: 1, Port: 80}) {
+		t.Fatal("invalid decode result:", v4)
+	}
+	if err = Unmarshal(&v4, url.Values{}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v4, ResetType{}) {
+		t.Fatal("invalid decode result:", v4)
+	}
+
+	// Disabled
+	val = url.Values{}
+	enc := NewEncoder(val)
+	enc.DisableTextMarshaler()
+
+	type LevelType struct {
+		IP    net.IP    `form:"ip"`
+		Level TextLevel `form:"level"`
+	}
+	if err = enc.Encode(&LevelType{IP: net.IP{1, 2}, Level: 1}); err != nil {
+		t.Fatal(err)
+	}
+	exp = url.Values{
+		"ip":    []string{"1", "2"},
+		"level": []string{"1"},
+	}
+	if !reflect.DeepEqual(val, exp) {
+		t.Fatal("invalid encode result:", val, "expected:", exp)
+	}
+
+	v3 := LevelType{}
+	dec = NewDecoder(exp)
+	dec.DisableTextUnmarshaler()
+	if err = dec.Decode(&v3); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v3, LevelType{IP: net.IP{1, 2}, Level: 1}) {
+		t.Fatal("invalid decode result:", v3)
+	}
+}
+
+func TestRequiredAndUnknownKeys(t *testing.T) {
+	type Address struct {
+		City string `form:"city,required"`
+	}
+	type TestType struct {
+		Name string   `form:"name,required"`
+		Tags []string `form:"tags,required"`
+		Addr *Address `form:"addr,required"`
+		Note string   `form:"note"`
+	}
+
+	// Required
+	v := TestType{}
+	err := Unmarshal(&v, url.Values{"name": []string{""}})
+	de, ok := err.(*DecodeError)
+	if !ok || de.Key != "name" || de.Field != "Name" || !errors.Is(err, ErrRequired) {
+		t.Fatal("expected required error for name, returns:", err)
+	}
+
+	dec := NewDecoder(url.Values{"addr.zip": []string{"1"}})
+	dec.SetNestStyle(NestDot)
+	dec.SetErrorMode(CollectErrors)
+	err = dec.Decode(&v)
+	me, ok := err.(MultiError)
+	if !ok || len(me) != 3 {
+		t.Fatal("expected 3 errors, returns:", err)
+	}
+	for i, key := range []string{"name", "tags", "addr.city"} {
+		if de := me[i].(*DecodeError); de.Key != key || de.Err != ErrRequired {
+			t.Fatal("invalid decode error:", de, "expected key:", key)
+		}
+	}
+
+	// Unknown keys
+	src := url.Values{
+		"name":      []string{"n"},
+		"tags":      []string{"a"},
+		"addr.city": []string{"c"},
+		"addr.zip":  []string{"1"},
+		"extra":     []string{"e"},
+	}
+	dec = NewDecoder(src)
+	dec.SetNestStyle(NestDot)
+	if err = dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	dec.DisallowUnknownKeys()
+	err = dec.Decode(&v)
+	me, ok = err.(MultiError)
+	if !ok || len(me) != 2 {
+		t.Fatal("expected 2 errors, returns:", err)
+	}
+	for i, key := range []string{"addr.zip", "extra"} {
+		if de := me[i].(*DecodeError); de.Key != key || de.Err != ErrUnknownKey {
+			t.Fatal("invalid decode error:", de, "expected key:", key)
+		}
+	}
+
+	delete(src, "extra")
+	err = dec.Decode(&v)
+	if de, ok := err.(*DecodeError); !ok || de.Key != "addr.zip" || de.Err != ErrUnknownKey {
+		t.Fatal("expected unknown key error for addr.zip, returns:", err)
+	}
+}
+
+func TestDefaultValue(t *testing.T) {
+	type TestType struct {
+		Page   int        `form:"page,default=1"`
+		Size   *int       `form:"size,default=20"`
+		Sort   string     `form:"sort,default=a|b"`
+		Tags   []string   `form:"tags,default=a|b"`
+		Since  time.Time  `form:"since,layout=2006-01-02,default=2020-01-02"`
+		Status CustomBool `form:"status,default=Y"`
+	}
+
+	size := 20
+	exp := TestType{
+		Page:   1,
+		Size:   &size,
+		Sort:   "a|b",
+		Tags:   []string{"a", "b"},
+		Since:  time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+		Status: true,
+	}
+
+	v := TestType{}
+	if err := Unmarshal(&v, url.Values{"page": []string{""}}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, exp) {
+		t.Fatal("invalid decode result:", v, "expected:", exp)
+	}
+
+	v = TestType{}
+	if err := Unmarshal(&v, url.Values{"page": []string{"2"}, "tags": []string{"c"}}); err != nil {
+		t.Fatal(err)
+	}
+	if v.Page != 2 || !reflect.DeepEqual(v.Tags, []string{"c"}) {
+		t.Fatal("invalid decode result:", v)
+	}
+}
+
+func TestPatchMode(t *testing.T) {
+	type Item struct {
+		Name  string `form:"name"`
+		Count int    `form:"count"`
+	}
+	type TestType struct {
+		Name  string         `form:"name"`
+		Age   int            `form:"age,default=18"`
+		Tags  []string       `form:"tags"`
+		Item  *Item          `form:"item"`
+		Extra *Item          `form:"extra"`
+		Items []Item         `form:"items"`
+		Meta  map[string]int `form:"meta"`
+	}
+
+	v := TestType{
+		Name:  "name",
+		Age:   20,
+		Tags:  []string{"a"},
+		Item:  &Item{Name: "item", Count: 1},
+		Items: []Item{{Name: "a", Count: 1}},
+		Meta:  map[string]int{"a": 1},
+	}
+	exp := TestType{
+		Name:  "name",
+		Age:   20,
+		Tags:  []string{"b", "c"},
+		Item:  &Item{Name: "item", Count: 2},
+		Items: []Item{{Name: "a", Count: 2}, {Name: "b"}},
+		Meta:  map[string]int{"a": 1, "b": 2},
+	}
+
+	dec := NewDecoder(url.Values{
+		"tags":          []string{"b", "c"},
+		"item.count":    []string{"2"},
+		"items.0.count": []string{"2"},
+		"items.1.name":  []string{"b"},
+		"meta.b":        []string{"2"},
+	})
+	dec.SetNestStyle(NestDot)
+	dec.SetPatchMode(true)
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, exp) {
+		t.Fatal("invalid decode result:", v, "expected:", exp)
+	}
+
+	// Pointers are allocated only if any field is set in flat mode
+	v = TestType{}
+	dec = NewDecoder(url.Values{"count": []string{"3"}})
+	dec.SetPatchMode(true)
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Item == nil || v.Item.Count != 3 || v.Extra == nil || v.Meta != nil {
+		t.Fatal("invalid decode result:", v)
+	}
+	dec = NewDecoder(url.Values{})
+	dec.SetPatchMode(true)
+	v = TestType{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, TestType{}) {
+		t.Fatal("invalid decode result:", v)
+	}
+}
+
+func TestBindRequest(t *testing.T) {
+	type TestType struct {
+		Page int    `form:"page"`
+		Name string `form:"name"`
+	}
+
+	// Query
+	v := TestType{}
+	r := httptest.NewRequest(http.MethodGet, "/?page=2&name=a", nil)
+	if err := BindRequest(r, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Page != 2 || v.Name != "a" {
+		t.Fatal("invalid bind result:", v)
+	}
+
+	// Form body takes precedence over the query
+	v = TestType{}
+	r = httptest.NewRequest(http.MethodPost, "/?page=2&name=a", strings.NewReader("name=b"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := BindRequest(r, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Page != 2 || v.Name != "b" {
+		t.Fatal("invalid bind result:", v)
+	}
+
+	// Post form only
+	v = TestType{}
+	r = httptest.NewRequest(http.MethodPost, "/?page=2", strings.NewReader("name=b"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := BindPostForm(r, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Page != 0 || v.Name != "b" {
+		t.Fatal("invalid bind result:", v)
+	}
+
+	// Errors
+	binder := &Binder{
+		MaxBodySize: 12,
+		Configure: func(d *Decoder) {
+			d.DisallowUnknownKeys()
+		},
+	}
+	for status, r := range map[int]*http.Request{
+		http.StatusBadRequest:            httptest.NewRequest(http.MethodGet, "/?page=a", nil),
+		http.StatusUnsupportedMediaType:  httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}")),
+		http.StatusRequestEntityTooLarge: httptest.NewRequest(http.MethodPut, "/", strings.NewReader("name=abcdefghijkl")),
+	} {
+		if status == http.StatusRequestEntityTooLarge {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.ContentLength = -1
+		}
+		err := binder.BindRequest(r, &v)
+		if be, ok := err.(*BindError); !ok || be.Status != status {
+			t.Fatal("expected bind error with status", status, "returns:", err)
+		}
+	}
+
+	r = httptest.NewRequest(http.MethodPatch, "/", strings.NewReader("name=b&x=1"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	err := binder.BindRequest(r, &v)
+	if be, ok := err.(*BindError); !ok || be.Status != http.StatusBadRequest || !errors.Is(err, ErrUnknownKey) {
+		t.Fatal("expected unknown key error, returns:", err)
+	}
+	// Options
+	binder = &Binder{
+		Options: []Option{WithTagName("query"), WithCaseInsensitive(true)},
+	}
+	type QueryType struct {
+		Page int `query:"page"`
+	}
+	q := QueryType{}
+	r = httptest.NewRequest(http.MethodGet, "/?PAGE=3", nil)
+	if err = binder.BindRequest(r, &q); err != nil {
+		t.Fatal(err)
+	}
+	if q.Page != 3 {
+		t.Fatal("invalid bind result:", q)
+	}
+}
+
+func TestMultipartDecoder(t *testing.T) {
+	type TestType struct {
+		Name   string                  `form:"name"`
+		Avatar *multipart.FileHeader   `form:"avatar,required"`
+		Photos []*multipart.FileHeader `form:"photos"`
+		Readme io.Reader               `form:"readme"`
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	_ = w.WriteField("name", "a")
+	for _, file := range []struct{ key, name, content string }{
+		{"avatar", "avatar.png", "png"},
+		{"photos", "1.jpg", "jpg1"},
+		{"photos", "2.jpg", "jpg2"},
+		{"readme", "README", "hello"},
+	} {
+		fw, _ := w.CreateFormFile(file.key, file.name)
+		_, _ = fw.Write([]byte(file.content))
+	}
+	_ = w.Close()
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer form.RemoveAll()
+
+	v := TestType{}
+	if err = NewMultipartDecoder(form).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != "a" || v.Avatar == nil || v.Avatar.Filename != "avatar.png" || len(v.Photos) != 2 || v.Readme == nil {
+		t.Fatal("invalid decode result:", v)
+	}
+	b, _ := ioutil.ReadAll(v.Readme)
+	v.Readme.(io.Closer).Close()
+	if string(b) != "hello" {
+		t.Fatal("invalid file content:", string(b))
+	}
+
+	// Limits
+	d := NewMultipartDecoder(form)
+	d.SetMaxFiles(1)
+	if err = d.Decode(&v); !errors.Is(err, ErrTooManyFiles) {
+		t.Fatal("expected too many files error, returns:", err)
+	}
+	d = NewMultipartDecoder(form)
+	d.SetMaxFileSize(4)
+	if err = d.Decode(&v); !errors.Is(err, ErrFileTooLarge) {
+		t.Fatal("expected file too large error, returns:", err)
+	}
+	if de, ok := err.(*DecodeError); !ok || de.Field != "Readme" || de.Value != "README" {
+		t.Fatal("invalid decode error:", err)
+	}
+
+	// Required
+	delete(form.File, "avatar")
+	if err = NewMultipartDecoder(form).Decode(&v); !errors.Is(err, ErrRequired) {
+		t.Fatal("expected required error, returns:", err)
+	}
+}
+
+func TestMultipartEncoder(t *testing.T) {
+	type TestType struct {
+		Name   string    `form:"name"`
+		Tags   []string  `form:"tags"`
+		Avatar []byte    `form:"avatar,file=avatar.png"`
+		Readme io.Reader `form:"readme"`
+		Empty  io.Reader `form:"empty"`
+	}
+
+	var body bytes.Buffer
+	v := TestType{
+		Name:   "a",
+		Tags:   []string{"x", "y"},
+		Avatar: []byte("png"),
+		Readme: strings.NewReader("hello"),
+	}
+	contentType, err := MarshalMultipart(&v, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["boundary"] == "" {
+		t.Fatal("invalid content type:", contentType)
+	}
+	form, err := multipart.NewReader(&body, params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer form.RemoveAll()
+
+	if !reflect.DeepEqual(form.Value, map[string][]string{"name": {"a"}, "tags": {"x", "y"}}) {
+		t.Fatal("invalid form values:", form.Value)
+	}
+	if len(form.File) != 2 || form.File["avatar"][0].Filename != "avatar.png" || form.File["readme"][0].Filename != "readme" {
+		t.Fatal("invalid form files:", form.File)
+	}
+	f, _ := form.File["avatar"][0].Open()
+	b, _ := ioutil.ReadAll(f)
+	f.Close()
+	if string(b) != "png" {
+		t.Fatal("invalid file content:", string(b))
+	}
+}
+
+func TestStreamEncoder(t *testing.T) {
+	type Inner struct {
+		City string `form:"city"`
+	}
+	type TestType struct {
+		Zeta  string   `form:"zeta"`
+		Alpha []int    `form:"alpha"`
+		Inner *Inner   `form:"inner"`
+		Empty []string `form:"empty"`
+		Mid   string   `form:"mid key"`
+	}
+
+	var b strings.Builder
+	e := NewStreamEncoder(&b)
+	e.SetNestStyle(NestBracket)
+	v := TestType{
+		Zeta:  "a&b",
+		Alpha: []int{1, 2},
+		Inner: &Inner{City: "x"},
+		Mid:   "=",
+	}
+	if err := e.Encode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "zeta=a%26b&alpha=1&alpha=2&inner%5Bcity%5D=x&mid+key=%3D" {
+		t.Fatal("invalid stream output:", b.String())
+	}
+
+	// Same result as Marshal
+	vals, _ := url.ParseQuery(b.String())
+	want := url.Values{}
+	enc := NewEncoder(want)
+	enc.SetNestStyle(NestBracket)
+	_ = enc.Encode(&v)
+	delete(want, "empty")
+	if !reflect.DeepEqual(vals, want) {
+		t.Fatal("stream output differs from Marshal:", vals, want)
+	}
+}
+
+func TestMarshalOrdered(t *testing.T) {
+	type TestType struct {
+		Nonce  string            `form:"nonce"`
+		Amount int               `form:"amount"`
+		Items  []string          `form:"items"`
+		Extra  map[string]string `form:"extra"`
+	}
+	v := TestType{
+		Nonce:  "n",
+		Amount: 100,
+		Items:  []string{"b", "a"},
+		Extra:  map[string]string{"z": "1", "c": "2", "m": "3"},
+	}
+
+	for _, c := range []struct {
+		less func(a, b Pair) bool
+		want string
+	}{
+		{nil, "nonce=n&amount=100&items=b&items=a&extra.c=2&extra.m=3&extra.z=1"},
+		{ByKey, "amount=100&extra.c=2&extra.m=3&extra.z=1&items=b&items=a&nonce=n"},
+		{func(a, b Pair) bool { return a.Key > b.Key }, "nonce=n&items=b&items=a&extra.z=1&extra.m=3&extra.c=2&amount=100"},
+	} {
+		for i := 0; i < 5; i++ {
+			p, err := MarshalOrdered(&v, c.less)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Encode() != c.want {
+				t.Fatal("invalid ordered result:", p.Encode(), "expected:", c.want)
+			}
+		}
+	}
+
+	p, _ := MarshalOrdered(&v, nil)
+	vals, _ := Marshal(&v)
+	if !reflect.DeepEqual(p.Values(), vals) {
+		t.Fatal("invalid values:", p.Values(), vals)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	type TestType struct {
+		Name   string   `form:"name" validate:"min=2,max=5"`
+		Age    *int     `form:"age" validate:"min=18"`
+		Code   string   `form:"code" validate:"len=4,regexp=^[0-9]+$"`
+		Status []string `form:"status" validate:"max=2,oneof=open closed"`
+		Email  string   `form:"email" validate:"email"`
+		Even   int      `form:"even" validate:"even"`
+		Absent string   `form:"absent" validate:"min=1"`
+	}
+	RegisterRule("even", func(v reflect.Value, _ string) error {
+		if v.Int()%2 != 0 {
+			return errors.New("must be even")
+		}
+		return nil
+	})
+
+	v := TestType{}
+	valid := url.Values{
+		"name":   []string{"abc"},
+		"age":    []string{"18"},
+		"code":   []string{"0123"},
+		"status": []string{"open", "closed"},
+		"email":  []string{"user@example.com"},
+		"even":   []string{"2"},
+	}
+	if err := Unmarshal(&v, valid); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(url.Values{
+		"name":   []string{"abcdef"},
+		"age":    []string{"17"},
+		"code":   []string{"01a3"},
+		"status": []string{"open", "pending"},
+		"email":  []string{"User <user@example.com>"},
+		"even":   []string{"3"},
+	})
+	d.SetErrorMode(CollectErrors)
+	errs, ok := d.Decode(&v).(MultiError)
+	if !ok || len(errs) != 6 {
+		t.Fatal("expected 6 validation errors, returns:", errs)
+	}
+	for i, rule := range []string{"max", "min", "regexp", "oneof", "email", "even"} {
+		var ve *ValidationError
+		if !errors.As(errs[i], &ve) || ve.Rule != rule {
+			t.Fatal("expected", rule, "validation error, returns:", errs[i])
+		}
+	}
+	if de := errs[0].(*DecodeError); de.Key != "name" || de.Field != "Name" || de.Value != "abcdef" {
+		t.Fatal("invalid decode error:", de)
+	}
+
+	// Values which cannot be decoded are not validated
+	err := Unmarshal(&v, url.Values{"age": []string{"x"}})
+	var ve *ValidationError
+	if err == nil || errors.As(err, &ve) {
+		t.Fatal("expected decoding error, returns:", err)
+	}
+	// Patterns take the rest of the tag, commas included
+	type PatternType struct {
+		Tag string `form:"tag" validate:"min=1,regexp=^[a-z]{1,3}$"`
+	}
+	p := PatternType{}
+	if err = Unmarshal(&p, url.Values{"tag": []string{"abc"}}); err != nil {
+		t.Fatal(err)
+	}
+	err = Unmarshal(&p, url.Values{"tag": []string{"abcd"}})
+	if !errors.As(err, &ve) || ve.Rule != "regexp" || ve.Param != "^[a-z]{1,3}$" {
+		t.Fatal("expected regexp validation error, returns:", err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	type TestType struct {
+		UserID int      `query:"user_id"`
+		Name   *string  `query:"name"`
+		IDs    []int    `query:"ids"`
+		Skip   string   `query:"-"`
+		Empty  []string `query:"empty"`
+	}
+
+	name := "a"
+	v := TestType{UserID: 1, Name: &name, IDs: []int{1, 2, 3}, Skip: "x"}
+	vals, err := Marshal(&v, WithTagName("query"), WithSeparator(","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vals.Encode() != "ids=1%2C2%2C3&name=a&user_id=1" {
+		t.Fatal("invalid marshal result:", vals.Encode())
+	}
+
+	v.Name = nil
+	vals, _ = Marshal(&v, WithTagName("query"), WithNullValue("~"))
+	if vals.Get("name") != "~" || len(vals["ids"]) != 3 {
+		t.Fatal("invalid marshal result:", vals.Encode())
+	}
+
+	src := url.Values{
+		"User_ID": []string{"2"},
+		"NAME":    []string{"~"},
+		"ids":     []string{"4,5", "6"},
+	}
+	v = TestType{Name: &name}
+	if err = Unmarshal(&v, src, WithTagName("query"), WithNullValue("~"), WithSeparator(","), WithCaseInsensitive(true)); err != nil {
+		t.Fatal(err)
+	}
+	if v.UserID != 2 || v.Name != nil || !reflect.DeepEqual(v.IDs, []int{4, 5, 6}) {
+		t.Fatal("invalid unmarshal result:", v)
+	}
+
+	// Case-sensitive by default
+	v = TestType{}
+	if err = Unmarshal(&v, url.Values{"User_ID": []string{"2"}}, WithTagName("query")); err != nil || v.UserID != 0 {
+		t.Fatal("invalid unmarshal result:", v, err)
+	}
+
+	// Original keys are reported
+	src["User_ID"] = []string{"x"}
+	src["ids"] = []string{"y"}
+	err = Unmarshal(&v, src, WithTagName("query"), WithCaseInsensitive(true), WithErrorMode(CollectErrors))
+	if errs, ok := err.(MultiError); !ok || len(errs) != 2 || errs[0].(*DecodeError).Key != "User_ID" {
+		t.Fatal("expected 2 decode errors, returns:", err)
+	}
+	// Missing keys are not null with an empty null token
+	type Addr struct {
+		City string `form:"city"`
+	}
+	type NullType struct {
+		Home  *Addr            `form:"home"`
+		Count *int             `form:"count"`
+		Addrs map[string]*Addr `form:"addrs"`
+		Items []*Addr          `form:"items"`
+	}
+	n := NullType{}
+	if err = Unmarshal(&n, url.Values{"city": {"x"}}, WithNullValue("")); err != nil {
+		t.Fatal(err)
+	}
+	if n.Home == nil || n.Home.City != "x" || n.Count != nil {
+		t.Fatal("invalid unmarshal result:", n)
+	}
+	n = NullType{}
+	d := NewDecoder(url.Values{"addrs.a.city": {"x"}, "items.0.city": {"y"}, "count": {""}}, WithNullValue(""))
+	d.SetNestStyle(NestDot)
+	if err = d.Decode(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Addrs["a"] == nil || n.Addrs["a"].City != "x" || len(n.Items) != 1 || n.Items[0] == nil || n.Count != nil {
+		t.Fatal("invalid unmarshal result:", n)
+	}
+	count := 1
+	n = NullType{Home: &Addr{City: "a"}, Count: &count}
+	d = NewDecoder(url.Values{}, WithNullValue(""))
+	d.SetNestStyle(NestDot)
+	d.SetPatchMode(true)
+	if err = d.Decode(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Home == nil || n.Home.City != "a" || n.Count != &count {
+		t.Fatal("invalid unmarshal result:", n)
+	}
+}
+
+func TestFallbackTags(t *testing.T) {
+	type Inner struct {
+		City string `json:"city"`
+	}
+	type TestType struct {
+		Inner
+		ID       int    `form:"id" json:"identifier"`
+		Name     string `json:"name,omitempty"`
+		Page     int    `query:"page"`
+		Password string `json:"-"`
+		Dash     string `json:"-,"`
+		Untagged string
+	}
+
+	opt := WithTagNames("form", "json", "query")
+	v := TestType{Inner: Inner{City: "x"}, ID: 1, Page: 2, Password: "secret", Dash: "d", Untagged: "u"}
+	vals, err := Marshal(&v, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vals.Encode() != "-=d&Untagged=u&city=x&id=1&page=2" {
+		t.Fatal("invalid marshal result:", vals.Encode())
+	}
+
+	v = TestType{}
+	vals.Set("name", "a")
+	vals.Set("Password", "secret")
+	if err = Unmarshal(&v, vals, opt); err != nil {
+		t.Fatal(err)
+	}
+	if v.City != "x" || v.ID != 1 || v.Name != "a" || v.Page != 2 || v.Password != "" || v.Dash != "d" {
+		t.Fatal("invalid unmarshal result:", v)
+	}
+
+	// The form tag only by default
+	vals, _ = Marshal(&v)
+	if vals.Get("Name") != "a" || vals.Get("Password") != "" {
+		t.Fatal("invalid marshal result:", vals.Encode())
+	}
+}
+
+func TestNaming(t *testing.T) {
+	for name, want := range map[string][]string{
+		"UserID":       {"user_id", "userId", "user-id"},
+		"HTTPServer2":  {"http_server2", "httpServer2", "http-server2"},
+		"FV64":         {"fv64", "fv64", "fv64"},
+		"Already_Snek": {"already_snek", "alreadySnek", "already-snek"},
+	} {
+		for i, naming := range []string{SnakeCase, CamelCase, KebabCase} {
+			if got := lookupNaming(naming)(name); got != want[i] {
+				t.Fatal("invalid", naming, "of", name, "returns:", got, "expected:", want[i])
+			}
+		}
+	}
+
+	type TestType struct {
+		UserID    int
+		FirstName string
+		Tagged    string `form:"TAG"`
+	}
+	v := TestType{UserID: 1, FirstName: "a", Tagged: "b"}
+	vals, err := Marshal(&v, WithNaming(SnakeCase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vals.Encode() != "TAG=b&first_name=a&user_id=1" {
+		t.Fatal("invalid marshal result:", vals.Encode())
+	}
+
+	RegisterNaming("upper", strings.ToUpper)
+	vals, _ = Marshal(&v, WithNaming("upper"))
+	if vals.Encode() != "FIRSTNAME=a&TAG=b&USERID=1" {
+		t.Fatal("invalid marshal result:", vals.Encode())
+	}
+
+	v = TestType{}
+	src := url.Values{"userId": []string{"2"}, "FIRSTNAME": []string{"c"}, "tag": []string{"d"}}
+	if err = Unmarshal(&v, src, WithNaming(CamelCase), WithCaseInsensitive(true)); err != nil {
+		t.Fatal(err)
+	}
+	if v.UserID != 2 || v.FirstName != "c" || v.Tagged != "d" {
+		t.Fatal("invalid unmarshal result:", v)
+	}
+}
+
+func TestSliceSeparator(t *testing.T) {
+	type TestType struct {
+		IDs    []int    `form:"ids,comma"`
+		Tags   []string `form:"tags,sep=|"`
+		Names  []string `form:"names"`
+		Paths  []string `form:"paths,sep=::"`
+		Scores [2]int   `form:"scores,comma"`
+	}
+
+	v := TestType{
+		IDs:    []int{1, 2, 3},
+		Tags:   []string{"a|b", `c\d`, ""},
+		Names:  []string{"x", "y"},
+		Paths:  []string{"/a", "b::c"},
+		Scores: [2]int{4, 5},
+	}
+	vals, err := Marshal(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"ids":    []string{"1,2,3"},
+		"tags":   []string{`a\|b|c\\d|`},
+		"names":  []string{"x", "y"},
+		"paths":  []string{`/a::b\::c`},
+		"scores": []string{"4,5"},
+	}
+	if !reflect.DeepEqual(vals, want) {
+		t.Fatal("invalid marshal result:", vals)
+	}
+
+	r := TestType{}
+	if err = Unmarshal(&r, vals); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, v) {
+		t.Fatal("invalid unmarshal result:", r)
+	}
+
+	// Global default, overridden by field options
+	vals, _ = Marshal(&v, WithSeparator(";"))
+	if vals.Get("names") != "x;y" || vals.Get("ids") != "1,2,3" {
+		t.Fatal("invalid marshal result:", vals)
+	}
+
+	// Repeated keys are split too
+	r = TestType{}
+	if err = Unmarshal(&r, url.Values{"ids": []string{"1,2", "3"}}); err != nil || !reflect.DeepEqual(r.IDs, []int{1, 2, 3}) {
+		t.Fatal("invalid unmarshal result:", r, err)
+	}
+}
+
+func TestArrayStyle(t *testing.T) {
+	type Inner struct {
+		Tags []string `form:"tags"`
+	}
+	type TestType struct {
+		IDs   []int  `form:"ids,required"`
+		Inner *Inner `form:"inner"`
+	}
+
+	v := TestType{IDs: []int{1, 2}, Inner: &Inner{Tags: []string{"a"}}}
+	for style, want := range map[ArrayStyle]string{
+		ArrayRepeat:   "ids=1&ids=2&inner[tags]=a",
+		ArrayBrackets: "ids[]=1&ids[]=2&inner[tags][]=a",
+		ArrayIndex:    "ids[0]=1&ids[1]=2&inner[tags][0]=a",
+	} {
+		var b strings.Builder
+		e := NewStreamEncoder(&b, WithArrayStyle(style))
+		e.SetNestStyle(NestBracket)
+		if err := e.Encode(&v); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := url.QueryUnescape(b.String())
+		if got != want {
+			t.Fatal("invalid encode result:", got, "expected:", want)
+		}
+
+		for _, nest := range []NestStyle{NestBracket, NestDot} {
+			vals, _ := url.ParseQuery(b.String())
+			r := TestType{}
+			d := NewDecoder(vals, WithArrayStyle(style))
+			d.SetNestStyle(nest)
+			d.DisallowUnknownKeys()
+			if err := d.Decode(&r); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(r, v) {
+				t.Fatal("invalid decode result:", r)
+			}
+		}
+	}
+
+	// Flat keys, sorted by index, plain keys accepted too
+	r := TestType{}
+	src := url.Values{"ids[10]": []string{"3"}, "ids[2]": []string{"2"}, "ids": []string{"1"}, "tags[0]": []string{"a"}}
+	if err := Unmarshal(&r, src, WithArrayStyle(ArrayIndex)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.IDs, []int{1, 2, 3}) || !reflect.DeepEqual(r.Inner.Tags, []string{"a"}) {
+		t.Fatal("invalid decode result:", r.IDs, r.Inner)
+	}
+	if err := Unmarshal(&r, url.Values{"ids[]": []string{"1"}}); !errors.Is(err, ErrRequired) {
+		t.Fatal("expected required error, returns:", err)
+	}
+}
+
+func TestMapField(t *testing.T) {
+	type TestType struct {
+		Name   string                    `form:"name"`
+		Meta   map[string]string         `form:"meta,required"`
+		Counts map[string]int            `form:"counts"`
+		Nested map[string]map[int]string `form:"nested"`
+		Rest   map[string]string         `form:",inline"`
+	}
+
+	v := TestType{
+		Name:   "a",
+		Meta:   map[string]string{"color": "red", "size": "xl"},
+		Counts: map[string]int{"x": 1},
+		Nested: map[string]map[int]string{"a": {1: "b"}},
+		Rest:   map[string]string{"other": "c"},
+	}
+	for nest, exp := range map[NestStyle]url.Values{
+		NestFlat: {
+			"name": {"a"}, "meta.color": {"red"}, "meta.size": {"xl"}, "counts.x": {"1"},
+			"nested.a.1": {"b"}, "other": {"c"},
+		},
+		NestBracket: {
+			"name": {"a"}, "meta[color]": {"red"}, "meta[size]": {"xl"}, "counts[x]": {"1"},
+			"nested[a][1]": {"b"}, "other": {"c"},
+		},
+	} {
+		vals := url.Values{}
+		e := NewEncoder(vals)
+		e.SetNestStyle(nest)
+		if err := e.Encode(&v); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(vals, exp) {
+			t.Fatal("invalid encode result:", vals, "expected:", exp)
+		}
+
+		r := TestType{}
+		d := NewDecoder(vals)
+		d.SetNestStyle(nest)
+		if err := d.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(r, v) {
+			t.Fatal("invalid decode result:", r, "expected:", v)
+		}
+	}
+
+	// Both notations are accepted in flat mode
+	r := TestType{}
+	src := url.Values{"meta[color]": {"red"}, "meta.size": {"xl"}, "counts[x]": {"a"}}
+	err := Unmarshal(&r, src)
+	if de, ok := err.(*DecodeError); !ok || de.Key != "counts.x" || de.Field != "Counts[x]" {
+		t.Fatal("expected decode error, returns:", err)
+	}
+	delete(src, "counts[x]")
+	d := NewDecoder(src)
+	d.DisallowUnknownKeys()
+	if err = d.Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Meta, v.Meta) || r.Counts != nil || len(r.Rest) != 0 {
+		t.Fatal("invalid decode result:", r)
+	}
+
+	if err = Unmarshal(&r, url.Values{"meta": {"red"}}); !errors.Is(err, ErrRequired) {
+		t.Fatal("expected required error, returns:", err)
+	}
+
+	// Entry names keep their case if case-insensitive, like the inline map ones
+	r = TestType{}
+	src = url.Values{"META[Color]": {"red"}, "Nested.A.1": {"b"}, "Other": {"c"}}
+	if err = Unmarshal(&r, src, WithCaseInsensitive(true)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Meta, map[string]string{"Color": "red"}) ||
+		!reflect.DeepEqual(r.Nested, map[string]map[int]string{"A": {1: "b"}}) ||
+		!reflect.DeepEqual(r.Rest, map[string]string{"Other": "c"}) {
+		t.Fatal("invalid decode result:", r)
+	}
+}
+
+func TestMapValues(t *testing.T) {
+	type Address struct {
+		City string `form:"city"`
+		Zip  int    `form:"zip"`
+	}
+	type TestType struct {
+		Params url.Values             `form:"params"`
+		Addrs  map[string]Address     `form:"addrs"`
+		Ptrs   map[string]*int        `form:"ptrs"`
+		Lists  map[string][]Address   `form:"lists"`
+		Rest   map[string]interface{} `form:",inline"`
+	}
+
+	one := 1
+	v := TestType{
+		Params: url.Values{"a": {"1", "2"}, "b": {"3"}},
+		Addrs:  map[string]Address{"home": {City: "x", Zip: 1}},
+		Ptrs:   map[string]*int{"one": &one, "nil": nil},
+		Lists:  map[string][]Address{"l": {{City: "y"}}},
+		Rest:   map[string]interface{}{"other": "c"},
+	}
+	exp := url.Values{
+		"params[a]":         {"1", "2"},
+		"params[b]":         {"3"},
+		"addrs[home][city]": {"x"},
+		"addrs[home][zip]":  {"1"},
+		"ptrs[one]":         {"1"},
+		"ptrs[nil]":         {"null"},
+		"lists[l][0][city]": {"y"},
+		"lists[l][0][zip]":  {"0"},
+		"other":             {"c"},
+	}
+	vals := url.Values{}
+	e := NewEncoder(vals)
+	e.SetNestStyle(NestBracket)
+	if err := e.Encode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vals, exp) {
+		t.Fatal("invalid encode result:", vals, "expected:", exp)
+	}
+
+	r := TestType{}
+	d := NewDecoder(vals)
+	d.SetNestStyle(NestBracket)
+	if err := d.Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, v) {
+		t.Fatal("invalid decode result:", r, "expected:", v)
+	}
+
+	// Catch-all maps of slices and structs
+	type CatchAll struct {
+		Name   string              `form:"name"`
+		Values map[string][]string `form:",inline"`
+	}
+	type CatchAllStructs struct {
+		Name  string             `form:"name"`
+		Addrs map[string]Address `form:",inline"`
+	}
+	src := url.Values{"name": {"a"}, "home.city": {"x"}, "home.zip": {"1", "2"}}
+	c := CatchAll{}
+	if err := Unmarshal(&c, src); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Values, map[string][]string{"home.city": {"x"}, "home.zip": {"1", "2"}}) {
+		t.Fatal("invalid decode result:", c)
+	}
+	cs := CatchAllStructs{}
+	if err := Unmarshal(&cs, src); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cs.Addrs, map[string]Address{"home": {City: "x", Zip: 1}}) {
+		t.Fatal("invalid decode result:", cs)
+	}
+	vals, _ = Marshal(&cs)
+	if !reflect.DeepEqual(vals, url.Values{"name": {"a"}, "home.city": {"x"}, "home.zip": {"1"}}) {
+		t.Fatal("invalid encode result:", vals)
+	}
+
+	// Errors in nested values are reported with their keys
+	src["home.zip"] = []string{"z"}
+	err := Unmarshal(&cs, src)
+	if de, ok := err.(*DecodeError); !ok || de.Key != "home.zip" || de.Field != "Addrs[home].Zip" {
+		t.Fatal("expected decode error, returns:", err)
+	}
+}
+
+func TestDepth(t *testing.T) {
+	type Node struct {
+		Val  int   `form:"val"`
+		Next *Node `form:"next"`
+	}
+
+	// Shared pointers are encoded as many times as referenced
+	shared := &Node{Val: 2}
+	type Pair struct {
+		A *Node `form:"a"`
+		B *Node `form:"b"`
+	}
+	vals := url.Values{}
+	e := NewEncoder(vals)
+	e.SetNestStyle(NestDot)
+	if err := e.Encode(&Pair{A: shared, B: shared}); err != nil {
+		t.Fatal(err)
+	}
+	exp := url.Values{"a.val": {"2"}, "a.next": {"null"}, "b.val": {"2"}, "b.next": {"null"}}
+	if !reflect.DeepEqual(vals, exp) {
+		t.Fatal("invalid encode result:", vals, "expected:", exp)
+	}
+
+	// Pointer cycles
+	n := &Node{Val: 1}
+	n.Next = &Node{Val: 2, Next: n}
+	err := e.Encode(n)
+	if de, ok := err.(*DepthError); !ok || !de.Cycle || de.Key != "next.next" {
+		t.Fatal("expected cycle error, returns:", err)
+	}
+	list := struct {
+		Nodes []*Node          `form:"nodes"`
+		Map   map[string]*Node `form:"map"`
+	}{Nodes: []*Node{n}}
+	if err = e.Encode(&list); err == nil {
+		t.Fatal("expected cycle error")
+	}
+	list.Nodes, list.Map = nil, map[string]*Node{"n": n}
+	if err = e.Encode(&list); err == nil {
+		t.Fatal("expected cycle error")
+	}
+
+	// Maximum depth
+	deep := &Node{}
+	for i := 0; i < 5; i++ {
+		deep = &Node{Val: i, Next: deep}
+	}
+	e.SetMaxDepth(3)
+	err = e.Encode(deep)
+	if de, ok := err.(*DepthError); !ok || de.Cycle || de.Depth != 3 || de.Key != "next.next.next" {
+		t.Fatal("expected depth error, returns:", err)
+	}
+	vals = url.Values{}
+	e = NewEncoder(vals)
+	e.SetNestStyle(NestDot)
+	if err = e.Encode(deep); err != nil {
+		t.Fatal(err)
+	}
+
+	r := Node{}
+	d := NewDecoder(vals)
+	d.SetNestStyle(NestDot)
+	if err = d.Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&r, deep) {
+		t.Fatal("invalid decode result:", r)
+	}
+	d.SetMaxDepth(3)
+	err = d.Decode(&r)
+	if de, ok := err.(*DepthError); !ok || de.Depth != 3 || de.Key != "next.next.next" {
+		t.Fatal("expected depth error, returns:", err)
+	}
+
+	// Recursive types in the top-level namespace
+	r = Node{}
+	if err = Unmarshal(&r, url.Values{"val": {"1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if r.Val != 1 || r.Next != nil {
+		t.Fatal("invalid decode result:", r)
+	}
+}
+
+type benchEmbed struct {
+	City string `form:"city"`
+	Zip  int    `form:"zip"`
+}
+
+type benchType struct {
+	Name   string   `form:"name"`
+	Age    int      `form:"age"`
+	Score  float64  `form:"score"`
+	Admin  bool     `form:"admin,omitempty"`
+	Tags   []string `form:"tags"`
+	Home   *benchEmbed
+	Custom CustomBool
+	benchEmbed
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	v := benchType{
+		Name:  "name",
+		Age:   10,
+		Score: 1.5,
+		Tags:  []string{"a", "b"},
+		Home:  &benchEmbed{City: "city", Zip: 1},
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStreamEncoder(b *testing.B) {
+	v := benchType{
+		Name:  "name",
+		Age:   10,
+		Score: 1.5,
+		Tags:  []string{"a", "b"},
+		Home:  &benchEmbed{City: "city", Zip: 1},
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := NewStreamEncoder(ioutil.Discard).Encode(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	src := url.Values{
+		"name":   []string{"name"},
+		"age":    []string{"10"},
+		"score":  []string{"1.5"},
+		"tags":   []string{"a", "b"},
+		"city":   []string{"city"},
+		"zip":    []string{"1"},
+		"Custom": []string{"Y"},
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v := benchType{}
+		if err := Unmarshal(&v, src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
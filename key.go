@@ -0,0 +1,234 @@
+package form
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NestStyle is the way keys of nested struct fields are built.
+type NestStyle int
+
+const (
+	// NestFlat flattens nested structs into the top-level namespace.
+	NestFlat NestStyle = iota
+	// NestDot joins nested keys with dots, e.g. addr.city.
+	NestDot
+	// NestBracket wraps nested keys in brackets, e.g. addr[city].
+	NestBracket
+)
+
+// ArrayStyle is the way keys of slice and array values are built.
+// Slices and arrays of structs always use indexed keys, e.g. items.0.name.
+type ArrayStyle int
+
+const (
+	// ArrayRepeat repeats the key for each value, e.g. ids=1&ids=2.
+	ArrayRepeat ArrayStyle = iota
+	// ArrayBrackets appends empty brackets to the key, e.g. ids[]=1&ids[]=2.
+	ArrayBrackets
+	// ArrayIndex appends the index of each value to the key, e.g. ids[0]=1&ids[1]=2.
+	ArrayIndex
+)
+
+// join returns the key of the field name nested in prefix.
+// Fields of nested structs are never prefixed in NestFlat style,
+// so a prefix only shows up there for elements of slices.
+func (s NestStyle) join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	if s == NestBracket {
+		return prefix + "[" + name + "]"
+	}
+	return prefix + "." + name
+}
+
+// index returns the key of the i-th element of the slice prefix.
+func (s NestStyle) index(prefix string, i int) string {
+	return s.join(prefix, strconv.Itoa(i))
+}
+
+// canonicalKey converts bracket notation into dot notation,
+// e.g. addr[city] to addr.city.
+func canonicalKey(key string) string {
+	i := strings.IndexByte(key, '[')
+	if i < 0 {
+		return key
+	}
+
+	var b strings.Builder
+	b.Grow(len(key))
+	b.WriteString(key[:i])
+	for _, c := range key[i:] {
+		switch c {
+		case '[':
+			b.WriteByte('.')
+		case ']':
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalValues returns src with all keys converted by canonicalKey.
+// src is returned as is if none of its keys uses bracket notation.
+func canonicalValues(src url.Values) url.Values {
+	found := false
+	for k := range src {
+		if strings.IndexByte(k, '[') >= 0 {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return src
+	}
+
+	dst := make(url.Values, len(src))
+	for k, vals := range src {
+		k = canonicalKey(k)
+		dst[k] = append(dst[k], vals...)
+	}
+	return dst
+}
+
+// foldValues returns src with all keys in lower case, recording the
+// smallest original key of each of them into names.
+func foldValues(src url.Values, names map[string]string) url.Values {
+	dst := make(url.Values, len(src))
+	for k, vals := range src {
+		lower := strings.ToLower(k)
+		if orig, ok := names[lower]; !ok || k < orig {
+			names[lower] = k
+		}
+		dst[lower] = append(dst[lower], vals...)
+	}
+	return dst
+}
+
+// nestedValues returns the values of the keys nested in key, converted into dot notation,
+// e.g. meta.color for both meta.color and meta[color], and the original keys.
+func nestedValues(src url.Values, key string) (url.Values, []string) {
+	var (
+		nested   url.Values
+		consumed []string
+	)
+	for k, vals := range src {
+		if len(k) <= len(key)+1 || (k[len(key)] != '.' && k[len(key)] != '[') || !strings.HasPrefix(k, key) {
+			continue
+		}
+		ck := canonicalKey(k)
+		if len(ck) <= len(key)+1 || ck[len(key)] != '.' {
+			continue
+		}
+		if nested == nil {
+			nested = url.Values{}
+		}
+		nested[ck] = append(nested[ck], vals...)
+		consumed = append(consumed, k)
+	}
+	return nested, consumed
+}
+
+// entryNames returns the sorted names of the entries nested in key, e.g. color and size
+// for meta.color, meta.size.width and meta.size.height.
+// All the keys are nested in an empty key.
+func entryNames(src url.Values, key string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for k := range src {
+		name := k
+		if key != "" {
+			name = k[len(key)+1:]
+		}
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			name = name[:i]
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// keySegment returns the segment n of the key in dot notation, e.g. size for meta.size.width and 1.
+func keySegment(key string, n int) string {
+	for ; n > 0; n-- {
+		i := strings.IndexByte(key, '.')
+		if i < 0 {
+			return ""
+		}
+		key = key[i+1:]
+	}
+	if i := strings.IndexByte(key, '.'); i >= 0 {
+		key = key[:i]
+	}
+	return key
+}
+
+// hasKeyPrefix reports whether src contains key or any key nested in it, in dot or bracket notation.
+func hasKeyPrefix(src url.Values, key string) bool {
+	if _, ok := src[key]; ok {
+		return true
+	}
+	for k := range src {
+		if len(k) > len(key) && (k[len(key)] == '.' || k[len(key)] == '[') && strings.HasPrefix(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexedKeys returns the keys of src made of key followed by an index between
+// open and end, e.g. ids[0] and ids[2], sorted by index.
+func indexedKeys(src url.Values, key, open, end string) []string {
+	var (
+		keys    []string
+		indices = map[string]int{}
+	)
+	for k := range src {
+		if len(k) <= len(key)+len(open)+len(end) || !strings.HasPrefix(k, key) ||
+			!strings.HasPrefix(k[len(key):], open) || !strings.HasSuffix(k, end) {
+			continue
+		}
+		idx, err := strconv.Atoi(k[len(key)+len(open) : len(k)-len(end)])
+		if err != nil || idx < 0 {
+			continue
+		}
+		indices[k] = idx
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return indices[keys[i]] < indices[keys[j]]
+	})
+	return keys
+}
+
+// keyIndices returns the sorted indices of elements nested in key, e.g. 0 and 2
+// for items.0.name and items.2.name.
+func keyIndices(src url.Values, key string) []int {
+	var indices []int
+	seen := map[int]bool{}
+	for k := range src {
+		if len(k) <= len(key)+1 || k[len(key)] != '.' || !strings.HasPrefix(k, key) {
+			continue
+		}
+		seg := k[len(key)+1:]
+		if i := strings.IndexByte(seg, '.'); i >= 0 {
+			seg = seg[:i]
+		}
+		idx, err := strconv.Atoi(seg)
+		if err != nil || idx < 0 || seen[idx] {
+			continue
+		}
+		seen[idx] = true
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+	return indices
+}
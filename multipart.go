@@ -0,0 +1,196 @@
+package form
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+var (
+	// ErrFileTooLarge is the cause of a DecodeError for uploaded files over the size limit.
+	ErrFileTooLarge = errors.New("file too large")
+	// ErrTooManyFiles is the cause of a DecodeError for keys with more uploaded files than the limit.
+	ErrTooManyFiles = errors.New("too many files")
+)
+
+var (
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeaderSliceType = reflect.TypeOf([]*multipart.FileHeader(nil))
+	multipartFileType   = reflect.TypeOf((*multipart.File)(nil)).Elem()
+	readerType          = reflect.TypeOf((*io.Reader)(nil)).Elem()
+)
+
+// NewMultipartDecoder returns a Decoder binding the text parts of form like
+// NewDecoder does, and the file parts into fields of type *multipart.FileHeader,
+// []*multipart.FileHeader, or interfaces implemented by multipart.File like io.Reader.
+// Files bound to interfaces are opened, and must be closed by the caller.
+func NewMultipartDecoder(form *multipart.Form, opts ...Option) *Decoder {
+	d := NewDecoder(form.Value, opts...)
+	d.files = form.File
+	return d
+}
+
+// SetMaxFileSize sets the maximum size of each uploaded file, no limit if zero.
+func (d *Decoder) SetMaxFileSize(n int64) {
+	d.maxFileSize = n
+}
+
+// SetMaxFiles sets the maximum number of files uploaded with the same key, no limit if zero.
+func (d *Decoder) SetMaxFiles(n int) {
+	d.maxFiles = n
+}
+
+// isFileType reports whether fields of type t are bound to uploaded files.
+func isFileType(t reflect.Type) bool {
+	switch {
+	case t == fileHeaderType, t == fileHeaderSliceType:
+		return true
+	case t.Kind() == reflect.Interface:
+		return t.NumMethod() > 0 && multipartFileType.Implements(t)
+	}
+	return false
+}
+
+// decodeFiles binds the files uploaded with the key into the field v of type t.
+func (d *Decoder) decodeFiles(v reflect.Value, t reflect.Type, key, path string, files []*multipart.FileHeader, st *decodeState) error {
+	if d.maxFiles > 0 && len(files) > d.maxFiles {
+		return d.fail(st, key, path, "", ErrTooManyFiles)
+	}
+	for i, fh := range files {
+		if d.maxFileSize > 0 && fh.Size > d.maxFileSize {
+			if t == fileHeaderSliceType {
+				path = fmt.Sprintf("%s[%d]", path, i)
+			}
+			return d.fail(st, key, path, fh.Filename, ErrFileTooLarge)
+		}
+	}
+
+	switch {
+	case t == fileHeaderSliceType:
+		v.Set(reflect.ValueOf(files))
+	case len(files) == 0:
+		v.Set(reflect.Zero(t))
+	case t == fileHeaderType:
+		v.Set(reflect.ValueOf(files[0]))
+	default:
+		f, err := files[0].Open()
+		if err != nil {
+			return d.fail(st, key, path, files[0].Filename, err)
+		}
+		v.Set(reflect.ValueOf(f))
+	}
+	return nil
+}
+
+// canonicalFiles returns files with all keys converted by canonicalKey.
+func canonicalFiles(files map[string][]*multipart.FileHeader) map[string][]*multipart.FileHeader {
+	dst := make(map[string][]*multipart.FileHeader, len(files))
+	for k, fhs := range files {
+		if strings.IndexByte(k, '[') >= 0 {
+			k = canonicalKey(k)
+		}
+		dst[k] = append(dst[k], fhs...)
+	}
+	return dst
+}
+
+// NewMultipartEncoder returns an Encoder writing the fields of a struct as parts of w.
+// Fields implementing io.Reader, and []byte or io.Reader fields with the file option,
+// e.g. `form:"avatar,file=avatar.png"`, are written as file parts. The file name
+// defaults to the base name of *os.File fields, or the key otherwise.
+// The caller must close w after encoding.
+func NewMultipartEncoder(w *multipart.Writer, opts ...Option) *Encoder {
+	e := NewEncoder(nil, opts...)
+	e.out = &multipartSink{w}
+	return e
+}
+
+// MarshalMultipart writes src as a multipart form into w, and returns its content type
+// with the boundary, e.g. for the Content-Type header of a request.
+func MarshalMultipart(src interface{}, w io.Writer, opts ...Option) (string, error) {
+	mw := multipart.NewWriter(w)
+	if err := NewMultipartEncoder(mw, opts...).Encode(src); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+	return mw.FormDataContentType(), nil
+}
+
+// fileSink is a sink accepting file parts.
+type fileSink interface {
+	sink
+	addFile(key, filename string, r io.Reader) error
+}
+
+// multipartSink writes into a multipart.Writer.
+type multipartSink struct {
+	w *multipart.Writer
+}
+
+func (s *multipartSink) add(key, value string) error {
+	return s.w.WriteField(key, value)
+}
+
+func (s *multipartSink) clear(string) {}
+
+func (s *multipartSink) addFile(key, filename string, r io.Reader) error {
+	w, err := s.w.CreateFormFile(key, filename)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// isUploadType reports whether fields of type t are written as file parts without the file option.
+func isUploadType(t reflect.Type) bool {
+	return t.Implements(readerType)
+}
+
+// encodeFile writes the field f of value v as a file part with the key.
+// Nil readers are skipped.
+func (e *Encoder) encodeFile(files fileSink, f *field, v reflect.Value, key string) error {
+	var r io.Reader
+	switch {
+	case (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil():
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		r = bytes.NewReader(v.Bytes())
+	case v.Type().Implements(readerType):
+		r = v.Interface().(io.Reader)
+	case v.CanAddr() && v.Addr().Type().Implements(readerType):
+		r = v.Addr().Interface().(io.Reader)
+	default:
+		return fmt.Errorf("file part not supported for %v", f.typ)
+	}
+
+	filename, _ := f.opts.Get("file")
+	if filename == "" {
+		filename = key
+		if n, ok := r.(interface{ Name() string }); ok {
+			filename = filepath.Base(n.Name())
+		}
+	}
+	return files.addFile(key, filename, r)
+}
+
+// foldFiles returns files with all keys in lower case, recording the
+// smallest original key of each of them into names, like foldValues.
+func foldFiles(files map[string][]*multipart.FileHeader, names map[string]string) map[string][]*multipart.FileHeader {
+	dst := make(map[string][]*multipart.FileHeader, len(files))
+	for k, fhs := range files {
+		lower := strings.ToLower(k)
+		if orig, ok := names[lower]; !ok || k < orig {
+			names[lower] = k
+		}
+		dst[lower] = append(dst[lower], fhs...)
+	}
+	return dst
+}
@@ -0,0 +1,90 @@
+package form
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Names of the built-in naming strategies, see WithNaming.
+const (
+	// SnakeCase converts UserID to user_id.
+	SnakeCase = "snake_case"
+	// CamelCase converts UserID to userId.
+	CamelCase = "camelCase"
+	// KebabCase converts UserID to user-id.
+	KebabCase = "kebab-case"
+)
+
+var (
+	namingMu sync.RWMutex
+	namings  = map[string]func(string) string{
+		SnakeCase: func(name string) string {
+			return strings.ToLower(strings.Join(splitWords(name), "_"))
+		},
+		CamelCase: camelCase,
+		KebabCase: func(name string) string {
+			return strings.ToLower(strings.Join(splitWords(name), "-"))
+		},
+	}
+)
+
+// RegisterNaming registers fn as the naming strategy name, converting Go field names to keys.
+// Strategies must be registered before encoding or decoding with them.
+func RegisterNaming(name string, fn func(string) string) {
+	namingMu.Lock()
+	defer namingMu.Unlock()
+	namings[name] = fn
+}
+
+// lookupNaming returns the naming strategy name, or nil if not registered.
+func lookupNaming(name string) func(string) string {
+	namingMu.RLock()
+	defer namingMu.RUnlock()
+	return namings[name]
+}
+
+// camelCase joins the lower case words of name, capitalizing all but the first one.
+func camelCase(name string) string {
+	var b strings.Builder
+	for i, w := range splitWords(name) {
+		w = strings.ToLower(w)
+		if i > 0 {
+			r := []rune(w)
+			r[0] = unicode.ToUpper(r[0])
+			w = string(r)
+		}
+		b.WriteString(w)
+	}
+	return b.String()
+}
+
+// splitWords splits a Go identifier into words, keeping acronyms and
+// trailing digits together, e.g. HTTPServer2ID to HTTP, Server2 and ID.
+func splitWords(name string) []string {
+	var (
+		words []string
+		runes = []rune(name)
+		start = 0
+	)
+	for i := 1; i < len(runes); i++ {
+		prev, cur := runes[i-1], runes[i]
+		switch {
+		case cur == '_' || cur == '-':
+			if start < i {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+		case unicode.IsUpper(cur) && (unicode.IsLower(prev) || unicode.IsDigit(prev)),
+			unicode.IsUpper(cur) && unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+			if start < i {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
@@ -0,0 +1,144 @@
+package form
+
+import (
+	"strings"
+)
+
+// Option configures an Encoder or a Decoder.
+type Option func(*options)
+
+// options holds the settings shared by Encoder and Decoder.
+type options struct {
+	tagNames   string // comma-separated
+	naming     string
+	nullValue  string
+	ignoreCase bool
+	separator  string
+	arrayStyle ArrayStyle
+	errorMode  ErrorMode
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		tagNames:  TagName,
+		nullValue: NullValue,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithTagName sets the name of the struct tag holding keys and options, TagName by default.
+func WithTagName(name string) Option {
+	return WithTagNames(name)
+}
+
+// WithTagNames sets the names of the struct tags holding keys and options, in order of
+// precedence, e.g. form, json and query. The first tag found on a field is used,
+// the others are ignored. Dashes and omitempty have the same meaning in all of them.
+func WithTagNames(names ...string) Option {
+	return func(o *options) {
+		o.tagNames = strings.Join(names, ",")
+	}
+}
+
+// WithNaming sets the naming strategy converting the Go names of fields without
+// a tag name to keys, e.g. SnakeCase or any strategy registered with RegisterNaming.
+// Go names are used as is if name is empty, which is the default, or not registered.
+func WithNaming(name string) Option {
+	return func(o *options) {
+		o.naming = name
+	}
+}
+
+// WithNullValue sets the token of nil pointers, NullValue by default.
+func WithNullValue(token string) Option {
+	return func(o *options) {
+		o.nullValue = token
+	}
+}
+
+// WithCaseInsensitive sets whether the Decoder matches keys regardless of case, false by default.
+// Encoders are not affected.
+func WithCaseInsensitive(ignore bool) Option {
+	return func(o *options) {
+		o.ignoreCase = ignore
+	}
+}
+
+// WithSeparator sets the separator joining the values of slices and arrays into
+// a single value, e.g. "," for ids=1,2,3. Values are repeated under the same key
+// if it is empty, which is the default. Slices of structs are not affected.
+// Fields with the comma or sep=<separator> option use their own separator.
+// Separators and backslashes inside values are escaped with a backslash.
+func WithSeparator(sep string) Option {
+	return func(o *options) {
+		o.separator = sep
+	}
+}
+
+// WithArrayStyle sets the way keys of slice and array values are built, ArrayRepeat
+// by default. Decoders accept plain repeated keys in all styles. Values joined with a
+// separator are always encoded under the key itself.
+func WithArrayStyle(s ArrayStyle) Option {
+	return func(o *options) {
+		o.arrayStyle = s
+	}
+}
+
+// sliceSeparator returns the separator of the slice or array field f, or an empty
+// string if its values are repeated.
+func (o *options) sliceSeparator(f *field) string {
+	if f.sep != "" {
+		return f.sep
+	}
+	return o.separator
+}
+
+// joinValues joins values with sep, escaping sep and backslashes with a backslash.
+func joinValues(values []string, sep string) string {
+	var b strings.Builder
+	for i, s := range values {
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		for j := 0; j < len(s); j++ {
+			if s[j] == '\\' || strings.HasPrefix(s[j:], sep) {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(s[j])
+		}
+	}
+	return b.String()
+}
+
+// splitValue splits s at each sep not escaped with a backslash, and unescapes the values.
+func splitValue(s, sep string) []string {
+	var (
+		values []string
+		b      strings.Builder
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case strings.HasPrefix(s[i:], sep):
+			values = append(values, b.String())
+			b.Reset()
+			i += len(sep) - 1
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return append(values, b.String())
+}
+
+// WithErrorMode sets the way decoding failures are reported, StopOnError by default.
+// Encoders are not affected.
+func WithErrorMode(m ErrorMode) Option {
+	return func(o *options) {
+		o.errorMode = m
+	}
+}
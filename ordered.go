@@ -0,0 +1,78 @@
+package form
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Pair is an encoded key/value pair.
+type Pair struct {
+	Key   string
+	Value string
+}
+
+// Pairs is an ordered list of encoded key/value pairs.
+type Pairs []Pair
+
+// Encode encodes the pairs into URL-encoded form in their order, e.g. as the canonical string to sign.
+func (p Pairs) Encode() string {
+	var b strings.Builder
+	for i, kv := range p {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(kv.Key))
+		b.WriteByte('=')
+		b.WriteString(url.QueryEscape(kv.Value))
+	}
+	return b.String()
+}
+
+// Values returns the pairs as url.Values.
+func (p Pairs) Values() url.Values {
+	v := make(url.Values, len(p))
+	for _, kv := range p {
+		v[kv.Key] = append(v[kv.Key], kv.Value)
+	}
+	return v
+}
+
+// ByKey orders pairs alphabetically by key, for MarshalOrdered.
+func ByKey(a, b Pair) bool {
+	return a.Key < b.Key
+}
+
+// NewOrderedEncoder returns an Encoder appending the pairs of a struct to dst,
+// in the declaration order of its fields. Entries of maps are ordered by key.
+func NewOrderedEncoder(dst *Pairs, opts ...Option) *Encoder {
+	e := NewEncoder(nil, opts...)
+	e.out = (*pairsSink)(dst)
+	return e
+}
+
+// MarshalOrdered encodes src into pairs in the declaration order of its fields,
+// then sorts them with less if it is not nil, e.g. ByKey. Sorting is stable,
+// so values of the same key keep their order.
+func MarshalOrdered(src interface{}, less func(a, b Pair) bool, opts ...Option) (Pairs, error) {
+	var p Pairs
+	if err := NewOrderedEncoder(&p, opts...).Encode(src); err != nil {
+		return nil, err
+	}
+	if less != nil {
+		sort.SliceStable(p, func(i, j int) bool {
+			return less(p[i], p[j])
+		})
+	}
+	return p, nil
+}
+
+// pairsSink appends to Pairs.
+type pairsSink Pairs
+
+func (s *pairsSink) add(key, value string) error {
+	*s = append(*s, Pair{key, value})
+	return nil
+}
+
+func (s *pairsSink) clear(string) {}
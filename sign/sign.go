@@ -0,0 +1,168 @@
+// Package sign computes and verifies signatures of structs encoded as canonical
+// form strings, like the ones of WeChat Pay and Alipay open platform APIs.
+package sign
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+
+	form "github.com/appootb/go-form"
+)
+
+const (
+	// Key is the key of the signature, excluded from canonical strings.
+	Key = "sign"
+	// NoSign is the tag option of fields excluded from canonical strings, e.g. `form:"sign_type,nosign"`.
+	NoSign = "nosign"
+)
+
+var (
+	// ErrInvalidSignature is returned when a signature does not match.
+	ErrInvalidSignature = errors.New("sign: invalid signature")
+	// ErrNoKey is returned when the key needed to sign or verify is missing.
+	ErrNoKey = errors.New("sign: missing key")
+)
+
+// Signer signs canonical strings, and verifies their signatures.
+type Signer interface {
+	Sign(canonical string) (string, error)
+	Verify(canonical, signature string) error
+}
+
+// Canonical returns the canonical string of the struct src: its key=value pairs
+// sorted by key and joined with '&'. Empty values, the Key and the fields with
+// the NoSign option are excluded, as well as nil pointers. Keys and values are not escaped.
+// The options are passed to the encoder, e.g. form.WithTagNames("form", "json").
+func Canonical(src interface{}, opts ...form.Option) (string, error) {
+	var pairs form.Pairs
+	// Nil pointers are encoded as empty values, so they are excluded too.
+	opts = append(opts[:len(opts):len(opts)], form.WithNullValue(""))
+	e := form.NewOrderedEncoder(&pairs, opts...)
+	e.SkipTagOption(NoSign)
+	if err := e.Encode(src); err != nil {
+		return "", err
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Key < pairs[j].Key
+	})
+
+	var b strings.Builder
+	for _, p := range pairs {
+		if p.Value == "" || p.Key == Key {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(p.Key)
+		b.WriteByte('=')
+		b.WriteString(p.Value)
+	}
+	return b.String(), nil
+}
+
+// Sign returns the signature of the canonical string of src.
+func Sign(src interface{}, s Signer, opts ...form.Option) (string, error) {
+	canonical, err := Canonical(src, opts...)
+	if err != nil {
+		return "", err
+	}
+	return s.Sign(canonical)
+}
+
+// Verify verifies signature against the canonical string of src.
+func Verify(src interface{}, s Signer, signature string, opts ...form.Option) error {
+	canonical, err := Canonical(src, opts...)
+	if err != nil {
+		return err
+	}
+	return s.Verify(canonical, signature)
+}
+
+// MD5 returns a Signer computing the upper case hex MD5 digest of the canonical
+// string followed by &key=<key>, as WeChat Pay does.
+func MD5(key string) Signer {
+	return digestSigner(func(canonical string) []byte {
+		sum := md5.Sum([]byte(canonical + "&key=" + key))
+		return sum[:]
+	})
+}
+
+// HMACSHA256 returns a Signer computing the upper case hex HMAC-SHA256 of the canonical string.
+func HMACSHA256(key []byte) Signer {
+	return digestSigner(func(canonical string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(canonical))
+		return mac.Sum(nil)
+	})
+}
+
+// digestSigner signs with upper case hex digests, verified case-insensitively.
+type digestSigner func(canonical string) []byte
+
+func (fn digestSigner) Sign(canonical string) (string, error) {
+	return strings.ToUpper(hex.EncodeToString(fn(canonical))), nil
+}
+
+func (fn digestSigner) Verify(canonical, signature string) error {
+	sum, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(sum, fn(canonical)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// RSASHA256 returns a Signer computing base64 encoded RSA PKCS #1 v1.5 signatures
+// of the SHA-256 digest of the canonical string, as Alipay RSA2 does.
+// Either key can be nil if only verifying or signing.
+func RSASHA256(priv *rsa.PrivateKey, pub *rsa.PublicKey) Signer {
+	return &rsaSigner{
+		priv: priv,
+		pub:  pub,
+	}
+}
+
+type rsaSigner struct {
+	priv *rsa.PrivateKey
+	pub  *rsa.PublicKey
+}
+
+func (s *rsaSigner) Sign(canonical string) (string, error) {
+	if s.priv == nil {
+		return "", ErrNoKey
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.priv, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+func (s *rsaSigner) Verify(canonical, signature string) error {
+	pub := s.pub
+	if pub == nil && s.priv != nil {
+		pub = &s.priv.PublicKey
+	}
+	if pub == nil {
+		return ErrNoKey
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	if rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package sign
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	form "github.com/appootb/go-form"
+)
+
+type payRequest struct {
+	AppID      string  `form:"appid"`
+	MchID      string  `form:"mch_id"`
+	DeviceInfo string  `form:"device_info"`
+	NonceStr   string  `form:"nonce_str"`
+	Body       string  `form:"body"`
+	Detail     string  `form:"detail,omitempty"`
+	TotalFee   int     `form:"total_fee,omitempty"`
+	SignType   string  `form:"sign_type,nosign"`
+	Sign       string  `form:"sign"`
+	Remark     *string `form:"remark"`
+}
+
+func TestCanonical(t *testing.T) {
+	// Example from the WeChat Pay documentation.
+	v := payRequest{
+		AppID:      "wxd930ea5d5a258f4f",
+		MchID:      "10000100",
+		DeviceInfo: "1000",
+		NonceStr:   "ibuaiVcKdpRxkhJA",
+		Body:       "test",
+		SignType:   "MD5",
+		Sign:       "ignored",
+	}
+	s, err := Canonical(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "appid=wxd930ea5d5a258f4f&body=test&device_info=1000&mch_id=10000100&nonce_str=ibuaiVcKdpRxkhJA" {
+		t.Fatal("invalid canonical string:", s)
+	}
+
+	sig, _ := MD5("192006250b4c09247ec02edce69f6a2d").Sign(s)
+	if sig != "9A0A8659F005D6984697E2CA0A9CF3B7" {
+		t.Fatal("invalid MD5 signature:", sig, "of", s)
+	}
+
+	// Nil pointers are excluded, even with a custom null token
+	if s, err = Canonical(&payRequest{AppID: "a"}, form.WithNullValue("~")); err != nil || s != "appid=a" {
+		t.Fatal("invalid canonical string:", s, err)
+	}
+	remark := "r"
+	if s, _ = Canonical(&payRequest{AppID: "a", Remark: &remark}); s != "appid=a&remark=r" {
+		t.Fatal("invalid canonical string:", s)
+	}
+}
+
+func TestSigners(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := payRequest{
+		AppID:    "wxd930ea5d5a258f4f",
+		MchID:    "10000100",
+		Body:     "test",
+		TotalFee: 1,
+	}
+	for name, s := range map[string]Signer{
+		"md5":        MD5("192006250b4c09247ec02edce69f6a2d"),
+		"hmacsha256": HMACSHA256([]byte("192006250b4c09247ec02edce69f6a2d")),
+		"rsasha256":  RSASHA256(priv, nil),
+	} {
+		v.Sign, err = Sign(&v, s)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if err = Verify(&v, s, v.Sign); err != nil {
+			t.Fatal(name, "expected valid signature, returns:", err)
+		}
+		v.TotalFee++
+		if err = Verify(&v, s, v.Sign); err != ErrInvalidSignature {
+			t.Fatal(name, "expected invalid signature, returns:", err)
+		}
+		v.TotalFee--
+	}
+
+	if _, err = Sign(&v, RSASHA256(nil, &priv.PublicKey)); err != ErrNoKey {
+		t.Fatal("expected missing key error, returns:", err)
+	}
+}
@@ -0,0 +1,37 @@
+package form
+
+import (
+	"io"
+	"net/url"
+)
+
+// NewStreamEncoder returns an Encoder writing application/x-www-form-urlencoded
+// output directly into w, in the declaration order of the struct fields.
+// Successive calls to Encode are joined with '&'.
+func NewStreamEncoder(w io.Writer, opts ...Option) *Encoder {
+	e := NewEncoder(nil, opts...)
+	e.out = &streamSink{w: w}
+	return e
+}
+
+// streamSink writes escaped key/value pairs into an io.Writer.
+type streamSink struct {
+	w       io.Writer
+	started bool
+	buf     []byte
+}
+
+func (s *streamSink) add(key, value string) error {
+	s.buf = s.buf[:0]
+	if s.started {
+		s.buf = append(s.buf, '&')
+	}
+	s.buf = append(s.buf, url.QueryEscape(key)...)
+	s.buf = append(s.buf, '=')
+	s.buf = append(s.buf, url.QueryEscape(value)...)
+	s.started = true
+	_, err := s.w.Write(s.buf)
+	return err
+}
+
+func (s *streamSink) clear(string) {}
@@ -7,19 +7,80 @@ import (
 
 const (
 	TagName = "form"
+	// ValidateTagName is the name of the tag holding the validation rules of a field,
+	// e.g. `validate:"min=1,max=10"`.
+	ValidateTagName = "validate"
 )
 
-// fieldAlias parses a field tag to get a field alias.
-func fieldAlias(field reflect.StructField) (alias string, options tagOptions) {
-	if tag := field.Tag.Get(TagName); tag != "" {
+// fieldTag returns the first non-empty tag of a field among the comma-separated
+// tag names, and the name of that tag.
+func fieldTag(field reflect.StructField, names string) (tag, name string) {
+	for names != "" {
+		name = names
+		if i := strings.IndexByte(names, ','); i >= 0 {
+			name, names = names[:i], names[i+1:]
+		} else {
+			names = ""
+		}
+		if tag = field.Tag.Get(name); tag != "" {
+			return tag, name
+		}
+	}
+	return "", ""
+}
+
+// fieldAlias parses the first field tag found among the comma-separated tag names
+// to get a field alias. The Go name, converted by rename if not nil, is used by default.
+func fieldAlias(field reflect.StructField, names string, rename func(string) string) (alias string, options tagOptions) {
+	if tag, _ := fieldTag(field, names); tag != "" {
 		alias, options = parseTag(tag)
 	}
 	if alias == "" {
 		alias = field.Name
+		if rename != nil {
+			alias = rename(alias)
+		}
 	}
 	return alias, options
 }
 
+// isIgnored reports whether the tags of a field exclude it, with a dash for the name.
+// Like encoding/json, a json tag of "-," names the field "-" instead.
+func isIgnored(field reflect.StructField, names string) bool {
+	tag, name := fieldTag(field, names)
+	if name == "json" && tag == "-," {
+		return false
+	}
+	alias, _ := parseTag(tag)
+	return alias == "-"
+}
+
+// fieldRules parses the validation tag of a field.
+// The pattern of a regexp rule takes the rest of the tag, commas included.
+func fieldRules(field reflect.StructField) []rule {
+	tag := field.Tag.Get(ValidateTagName)
+	if tag == "" {
+		return nil
+	}
+	var rules []rule
+	for tag != "" {
+		s := tag
+		if strings.HasPrefix(s, "regexp=") {
+			tag = ""
+		} else if i := strings.IndexByte(s, ','); i >= 0 {
+			s, tag = s[:i], s[i+1:]
+		} else {
+			tag = ""
+		}
+		r := rule{name: s}
+		if i := strings.IndexByte(s, '='); i >= 0 {
+			r.name, r.param = s[:i], s[i+1:]
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
 // tagOptions is the string following a comma in a struct field's tag, or
 // the empty string. It does not include the leading comma.
 type tagOptions []string
@@ -40,3 +101,13 @@ func (o tagOptions) Contains(option string) bool {
 	}
 	return false
 }
+
+// Get returns the value of the specified option in the form of option=value.
+func (o tagOptions) Get(option string) (string, bool) {
+	for _, s := range o {
+		if len(s) > len(option) && s[len(option)] == '=' && strings.HasPrefix(s, option) {
+			return s[len(option)+1:], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,261 @@
+package form
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// RuleFunc checks the decoded value v of a field against param,
+// the text after '=' in the rule, e.g. 3 for min=3.
+// Pointers are dereferenced before rules are checked.
+type RuleFunc func(v reflect.Value, param string) error
+
+// ValidationError is the cause of a DecodeError for a value breaking a validation rule.
+type ValidationError struct {
+	Rule  string // rule name, e.g. min
+	Param string // rule parameter, e.g. 3
+	Err   error  // underlying error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Param == "" {
+		return fmt.Sprintf("rule %s: %v", e.Rule, e.Err)
+	}
+	return fmt.Sprintf("rule %s=%s: %v", e.Rule, e.Param, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// rule is a validation rule parsed from a field tag.
+type rule struct {
+	name  string
+	param string
+}
+
+var (
+	rulesMu      sync.RWMutex
+	ruleRegistry = map[string]RuleFunc{
+		"min":    minRule,
+		"max":    maxRule,
+		"len":    lenRule,
+		"oneof":  eachRule(oneOfRule),
+		"regexp": eachRule(regexpRule),
+		"email":  eachRule(emailRule),
+	}
+
+	regexpCache sync.Map // map[string]*regexp.Regexp
+)
+
+// RegisterRule registers fn as the validation rule name, replacing any rule
+// of the same name, including the built-in ones.
+func RegisterRule(name string, fn RuleFunc) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	ruleRegistry[name] = fn
+}
+
+// lookupRule returns the validation rule name, or nil if not registered.
+func lookupRule(name string) RuleFunc {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	return ruleRegistry[name]
+}
+
+// validate checks the decoded field v against the rules of the field f.
+func (d *Decoder) validate(f *field, v reflect.Value, key, path, value string, st *decodeState) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	for _, r := range f.rules {
+		fn := lookupRule(r.name)
+		if fn == nil {
+			return d.fail(st, key, path, value, fmt.Errorf("unknown validation rule %q", r.name))
+		}
+		if err := fn(v, r.param); err != nil {
+			err = &ValidationError{
+				Rule:  r.name,
+				Param: r.param,
+				Err:   err,
+			}
+			if err = d.fail(st, key, path, value, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// minRule checks numbers against the minimum value, and strings, slices,
+// arrays and maps against the minimum length.
+func minRule(v reflect.Value, param string) error {
+	if n, ok, err := number(v, param); ok {
+		if err == nil && n < 0 {
+			err = fmt.Errorf("must be at least %s", param)
+		}
+		return err
+	}
+	if n, ok, err := length(v, param); ok {
+		if err == nil && n < 0 {
+			err = fmt.Errorf("length must be at least %s", param)
+		}
+		return err
+	}
+	return fmt.Errorf("unsupported type %v", v.Type())
+}
+
+// maxRule checks numbers against the maximum value, and strings, slices,
+// arrays and maps against the maximum length.
+func maxRule(v reflect.Value, param string) error {
+	if n, ok, err := number(v, param); ok {
+		if err == nil && n > 0 {
+			err = fmt.Errorf("must be at most %s", param)
+		}
+		return err
+	}
+	if n, ok, err := length(v, param); ok {
+		if err == nil && n > 0 {
+			err = fmt.Errorf("length must be at most %s", param)
+		}
+		return err
+	}
+	return fmt.Errorf("unsupported type %v", v.Type())
+}
+
+// lenRule checks the exact length of strings, slices, arrays and maps.
+func lenRule(v reflect.Value, param string) error {
+	n, ok, err := length(v, param)
+	if !ok {
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	if err == nil && n != 0 {
+		err = fmt.Errorf("length must be %s", param)
+	}
+	return err
+}
+
+// oneOfRule checks that the value is one of the space-separated values of param.
+func oneOfRule(v reflect.Value, param string) error {
+	s := format(v)
+	for _, p := range strings.Fields(param) {
+		if s == p {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", param)
+}
+
+// regexpRule checks that strings match the pattern param.
+func regexpRule(v reflect.Value, param string) error {
+	re, ok := regexpCache.Load(param)
+	if !ok {
+		compiled, err := regexp.Compile(param)
+		if err != nil {
+			return err
+		}
+		re, _ = regexpCache.LoadOrStore(param, compiled)
+	}
+	if !re.(*regexp.Regexp).MatchString(format(v)) {
+		return fmt.Errorf("must match %s", param)
+	}
+	return nil
+}
+
+var errInvalidEmail = errors.New("invalid email address")
+
+// emailRule checks that strings are bare email addresses, e.g. user@example.com.
+func emailRule(v reflect.Value, _ string) error {
+	s := format(v)
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return errInvalidEmail
+	}
+	return nil
+}
+
+// eachRule applies fn to each element of slices and arrays, or to the value itself.
+func eachRule(fn RuleFunc) RuleFunc {
+	return func(v reflect.Value, param string) error {
+		if k := v.Kind(); k != reflect.Slice && k != reflect.Array {
+			return fn(v, param)
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := fn(reflect.Indirect(v.Index(i)), param); err != nil {
+				return fmt.Errorf("element %d: %v", i, err)
+			}
+		}
+		return nil
+	}
+}
+
+// number compares numbers to param, returning the sign of v - param.
+// ok is false if v is not a number.
+func number(v reflect.Value, param string) (cmp int, ok bool, err error) {
+	var n float64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	default:
+		return 0, false, nil
+	}
+	p, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid parameter %q", param)
+	}
+	switch {
+	case n < p:
+		return -1, true, nil
+	case n > p:
+		return 1, true, nil
+	}
+	return 0, true, nil
+}
+
+// length compares the length of strings, in runes, slices, arrays and maps to param,
+// returning the sign of the difference. ok is false if v has no length.
+func length(v reflect.Value, param string) (cmp int, ok bool, err error) {
+	var n int
+	switch v.Kind() {
+	case reflect.String:
+		n = utf8.RuneCountInString(v.String())
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n = v.Len()
+	default:
+		return 0, false, nil
+	}
+	p, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid parameter %q", param)
+	}
+	switch {
+	case n < p:
+		return -1, true, nil
+	case n > p:
+		return 1, true, nil
+	}
+	return 0, true, nil
+}
+
+// format returns the text of strings, or the default format of other values.
+func format(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return v.String()
+	}
+	return fmt.Sprint(v.Interface())
+}